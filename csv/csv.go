@@ -42,15 +42,19 @@ func Module() map[string]tengo.Object {
 	}
 }
 
-func csvWrite(args interop.ArgMap) (tengo.Object, error) {
-	file, _ := args.GetString("file")
-
+// WriteFile writes the rows to the CSV file, truncating it if it exists
+func WriteFile(file string, rows [][]string) error {
 	f, err := os.Create(file)
 	if err != nil {
-		return interop.GoErrToTErr(err), nil
+		return err
 	}
+	defer f.Close()
+
+	return csv.NewWriter(f).WriteAll(rows)
+}
 
-	writer := makeCSVWriter(csv.NewWriter(f))
+func csvWrite(args interop.ArgMap) (tengo.Object, error) {
+	file, _ := args.GetString("file")
 
 	rows, ok := args.GetStringSliceSlice("data")
 	if !ok {
@@ -58,9 +62,12 @@ func csvWrite(args interop.ArgMap) (tengo.Object, error) {
 		rows = append(rows, row)
 	}
 
-	return writer.writeAll(interop.ArgMap{
-		"rows": rows,
-	})
+	err := WriteFile(file, rows)
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+
+	return nil, nil
 }
 
 func csvWriter(args interop.ArgMap) (tengo.Object, error) {
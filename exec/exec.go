@@ -3,20 +3,48 @@ package exec
 import (
 	"context"
 	"errors"
+	"fmt"
 	"os"
 	"os/exec"
 	"os/signal"
+	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 
 	"github.com/analog-substance/tengo/v2"
 	"github.com/analog-substance/tengomod/interop"
 )
 
 var ErrSignaled error = errors.New("process signaled to close")
+var ErrTimeout error = errors.New("process timed out")
+var ErrNotStarted error = errors.New("process not started because an earlier command failed to start")
+
+type module struct {
+	getCompiled func() *tengo.Compiled
+	ctx         context.Context
+
+	mutex     sync.Mutex
+	processes map[*ExecProcess]struct{}
+	watching  bool
+}
+
+func Module(getCompiled func() *tengo.Compiled, ctx context.Context) map[string]tengo.Object {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	m := &module{
+		getCompiled: getCompiled,
+		ctx:         ctx,
+		processes:   make(map[*ExecProcess]struct{}),
+	}
 
-func Module() map[string]tengo.Object {
 	return map[string]tengo.Object{
-		"err_signaled": interop.GoErrToTErr(ErrSignaled),
+		"err_signaled":    interop.GoErrToTErr(ErrSignaled),
+		"err_timeout":     interop.GoErrToTErr(ErrTimeout),
+		"err_canceled":    interop.GoErrToTErr(ErrCanceled),
+		"err_not_started": interop.GoErrToTErr(ErrNotStarted),
 		"run_with_sig_handler": &interop.AdvFunction{
 			Name:    "run_with_sig_handler",
 			NumArgs: interop.MinArgs(1),
@@ -27,7 +55,47 @@ func Module() map[string]tengo.Object {
 			Name:    "cmd",
 			NumArgs: interop.MinArgs(1),
 			Args:    []interop.AdvArg{interop.StrArg("cmd-name"), interop.StrSliceArg("args", true)},
-			Value:   tengoCmd,
+			Value:   m.tengoCmd,
+		},
+		"pipeline": &tengo.UserFunction{
+			Name:  "pipeline",
+			Value: tengoPipeline,
+		},
+		"parallel": &interop.AdvFunction{
+			Name:    "parallel",
+			NumArgs: interop.ArgRange(1, 2),
+			Args: []interop.AdvArg{
+				interop.SliceArg("cmds", false),
+				interop.MapArg("options",
+					interop.IntArg("concurrency"),
+					interop.BoolArg("fail_fast"),
+					interop.CompileFuncArg("on_done"),
+				),
+			},
+			Value: m.tengoParallel,
+		},
+		"look_path": &interop.AdvFunction{
+			Name:    "look_path",
+			NumArgs: interop.ExactArgs(1),
+			Args:    []interop.AdvArg{interop.StrArg("name")},
+			Value:   tengoLookPath,
+		},
+		"require": &interop.AdvFunction{
+			Name:    "require",
+			NumArgs: interop.ArgRange(1, 2),
+			Args: []interop.AdvArg{
+				interop.StrArg("name"),
+				interop.MapArg("options",
+					interop.StrArg("min_version"),
+					interop.StrSliceArg("version_args", false),
+					interop.RegexArg("version_regex"),
+				),
+			},
+			Value: tengoRequire,
+		},
+		"tools": &tengo.UserFunction{
+			Name:  "tools",
+			Value: tengoTools,
 		},
 	}
 }
@@ -44,7 +112,7 @@ func tengoRunWithSigHandler(args interop.ArgMap) (tengo.Object, error) {
 	return nil, nil
 }
 
-func tengoCmd(args interop.ArgMap) (tengo.Object, error) {
+func (m *module) tengoCmd(args interop.ArgMap) (tengo.Object, error) {
 	cmdName, _ := args.GetString("cmd-name")
 	cmdArgs, _ := args.GetStringSlice("args")
 
@@ -54,7 +122,69 @@ func tengoCmd(args interop.ArgMap) (tengo.Object, error) {
 	cmd.Stdout = os.Stdout
 	cmd.Stdin = os.Stdin
 
-	return makeExecCmd(cmd), nil
+	return makeExecCmd(m, cmd), nil
+}
+
+// tengoPipeline creates a pipeline connecting the stdout of each command to the stdin of the next
+// Represents 'exec.pipeline(cmds ...ExecCmd) ExecPipeline'
+func tengoPipeline(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) == 0 {
+		return nil, tengo.ErrWrongNumArguments
+	}
+
+	var cmds []*ExecCmd
+	for i, arg := range args {
+		cmd, ok := arg.(*ExecCmd)
+		if !ok {
+			return nil, tengo.ErrInvalidArgumentType{
+				Name:     fmt.Sprintf("cmds[%d]", i),
+				Expected: "exec-cmd",
+				Found:    arg.TypeName(),
+			}
+		}
+
+		cmds = append(cmds, cmd)
+	}
+
+	return makeExecPipeline(cmds), nil
+}
+
+// track keeps a reference to the started process so it can be killed when the module's context is cancelled.
+// Processes started after the context is done are killed right away.
+func (m *module) track(proc *ExecProcess) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.ctx.Err() != nil {
+		proc.kill()
+		return
+	}
+
+	m.processes[proc] = struct{}{}
+
+	if !m.watching && m.ctx.Done() != nil {
+		m.watching = true
+		go m.killOnDone()
+	}
+}
+
+func (m *module) untrack(proc *ExecProcess) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.processes, proc)
+}
+
+// killOnDone kills all tracked processes once the module's context is done
+func (m *module) killOnDone() {
+	<-m.ctx.Done()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for proc := range m.processes {
+		proc.kill()
+	}
 }
 
 func RunWithSigHandler(name string, args ...string) error {
@@ -68,15 +198,44 @@ func RunWithSigHandler(name string, args ...string) error {
 }
 
 func RunCmdWithSigHandler(cmd *exec.Cmd) error {
+	return runCmdWithSigHandler(cmd, 0)
+}
+
+// runCmdWithSigHandler runs the command, relaying trapped signals to it. If timeout is greater than 0,
+// the command's process group is killed once the timeout expires.
+func runCmdWithSigHandler(cmd *exec.Cmd, timeout time.Duration) error {
+	return runCmdsWithSigHandler([]*exec.Cmd{cmd}, timeout, nil, nil)[0]
+}
+
+// runCmdsWithSigHandler starts all the commands, relaying trapped signals to each of them, then waits for them
+// in order. If timeout is greater than 0, the commands' process groups are killed once the timeout expires.
+// onStarted is called once all commands have started and onExited is called with the index of each command
+// that exits. The returned slice contains the error of each command. When a command fails to start, the
+// commands after it are never started and get ErrNotStarted.
+func runCmdsWithSigHandler(cmds []*exec.Cmd, timeout time.Duration, onStarted func(), onExited func(int)) []error {
+	if timeout > 0 {
+		for _, cmd := range cmds {
+			setProcessGroup(cmd)
+		}
+	}
+
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
 
-	// relay trapped signals to the spawned process
-	signaled := false
+	var mutex sync.Mutex
+	var started []*exec.Cmd
+
+	// relay trapped signals to the spawned processes
+	var signaled atomic.Bool
 	go func() {
 		for sig := range sigs {
-			signaled = true
-			cmd.Process.Signal(sig)
+			signaled.Store(true)
+
+			mutex.Lock()
+			for _, cmd := range started {
+				cmd.Process.Signal(sig)
+			}
+			mutex.Unlock()
 		}
 	}()
 
@@ -85,24 +244,81 @@ func RunCmdWithSigHandler(cmd *exec.Cmd) error {
 		close(sigs)
 	}()
 
-	if err := cmd.Start(); err != nil {
-		return err
-	}
+	errs := make([]error, len(cmds))
+	for i, cmd := range cmds {
+		err := cmd.Start()
+		if err != nil {
+			errs[i] = err
+			for j := i + 1; j < len(cmds); j++ {
+				errs[j] = ErrNotStarted
+			}
 
-	if err := cmd.Wait(); err != nil {
-		exiterr, ok := err.(*exec.ExitError)
-		if !ok {
-			return err
+			// Don't leave the previous commands running without the rest of the pipeline
+			mutex.Lock()
+			for _, c := range started {
+				c.Process.Kill()
+			}
+			mutex.Unlock()
+
+			cmds = cmds[:i]
+			break
 		}
 
-		if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
-			if !signaled {
-				signaled = status.Signaled()
+		mutex.Lock()
+		started = append(started, cmd)
+		mutex.Unlock()
+	}
+
+	if onStarted != nil {
+		onStarted()
+	}
+
+	var timedOut atomic.Bool
+	if timeout > 0 {
+		timer := time.AfterFunc(timeout, func() {
+			timedOut.Store(true)
+			for _, cmd := range cmds {
+				killProcessGroup(cmd)
 			}
+		})
+		defer timer.Stop()
+	}
+
+	for i, cmd := range cmds {
+		errs[i] = waitCmd(cmd, i == len(cmds)-1, &signaled, &timedOut)
+
+		if onExited != nil {
+			onExited(i)
+		}
+	}
+
+	return errs
+}
+
+// waitCmd waits for the command to exit, returning ErrTimeout if the timeout killed it or ErrSignaled if
+// a trapped signal was relayed to it or it was killed by a signal. Only the final stage of a pipeline
+// reports being killed, as the other stages are expected to get SIGPIPE once the next stage exits.
+func waitCmd(cmd *exec.Cmd, final bool, signaled *atomic.Bool, timedOut *atomic.Bool) error {
+	err := cmd.Wait()
+
+	var sig syscall.Signal
+	if exiterr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exiterr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			sig = status.Signal()
 		}
+	} else if err != nil {
+		return err
+	}
+
+	if timedOut.Load() && sig != 0 {
+		return ErrTimeout
+	}
+
+	if signaled.Load() {
+		return ErrSignaled
 	}
 
-	if signaled {
+	if sig != 0 && final {
 		return ErrSignaled
 	}
 
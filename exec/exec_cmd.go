@@ -1,10 +1,15 @@
 package exec
 
 import (
+	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/analog-substance/tengo/v2"
 	"github.com/analog-substance/tengomod/interop"
@@ -14,6 +19,11 @@ import (
 type ExecCmd struct {
 	types.PropObject
 	Value *exec.Cmd
+
+	module   *module
+	timeout  time.Duration
+	closers  []io.Closer
+	onStdout *tengo.CompiledFunction
 }
 
 // TypeName should return the name of the type.
@@ -37,8 +47,113 @@ func (c *ExecCmd) CanIterate() bool {
 	return false
 }
 
+// addCloser registers a file that should be closed once the command finishes
+func (c *ExecCmd) addCloser(closer io.Closer) {
+	c.closers = append(c.closers, closer)
+}
+
+func (c *ExecCmd) closeFiles() {
+	for _, closer := range c.closers {
+		closer.Close()
+	}
+	c.closers = nil
+}
+
+// stdoutCallback returns the function running the stdout callback with a line, or nil if none is set.
+// When lock isn't nil, it is held while the callback runs so the callbacks of commands running at the
+// same time never run concurrently.
+func (c *ExecCmd) stdoutCallback(lock sync.Locker) (func(string) error, error) {
+	if c.onStdout == nil {
+		return nil, nil
+	}
+
+	runner, err := interop.NewModuleFuncRunner(c.onStdout, c.module.getCompiled, c.module.ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(line string) error {
+		if lock != nil {
+			lock.Lock()
+			defer lock.Unlock()
+		}
+
+		_, err := runner.Run(interop.GoStrToTStr(line))
+		return err
+	}, nil
+}
+
+// watchStdout passes each line of stdout to onLine if it isn't nil. The returned function waits for the
+// remaining lines to be processed and returns the first error from onLine.
+func (c *ExecCmd) watchStdout(onLine func(string) error) func() error {
+	if onLine == nil {
+		return func() error {
+			return nil
+		}
+	}
+
+	pr, pw := io.Pipe()
+	if c.Value.Stdout != nil {
+		c.Value.Stdout = io.MultiWriter(c.Value.Stdout, pw)
+	} else {
+		c.Value.Stdout = pw
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		var callbackErr error
+
+		scanner := bufio.NewScanner(pr)
+		for scanner.Scan() {
+			if callbackErr != nil {
+				continue
+			}
+
+			callbackErr = onLine(scanner.Text())
+		}
+
+		// Make sure the process never blocks writing to stdout
+		io.Copy(io.Discard, pr)
+		done <- callbackErr
+	}()
+
+	return func() error {
+		pw.Close()
+		return <-done
+	}
+}
+
+// runCmd runs the command with the signal handler. onStarted is called once the command has started.
+// The stdout callback is run while the command runs, holding lock if it isn't nil.
+func (c *ExecCmd) runCmd(onStarted func(), lock sync.Locker) error {
+	defer c.closeFiles()
+
+	onLine, err := c.stdoutCallback(lock)
+	if err != nil {
+		return err
+	}
+	finish := c.watchStdout(onLine)
+
+	err = runCmdsWithSigHandler([]*exec.Cmd{c.Value}, c.timeout, onStarted, nil)[0]
+	callbackErr := finish()
+	if err == nil {
+		err = callbackErr
+	}
+
+	return err
+}
+
+// exitCode returns the exit code of the command or -1 if it hasn't exited
+func (c *ExecCmd) exitCode() int {
+	if c.Value.ProcessState == nil {
+		return -1
+	}
+
+	return c.Value.ProcessState.ExitCode()
+}
+
 func (c *ExecCmd) run(args ...tengo.Object) (tengo.Object, error) {
-	err := RunCmdWithSigHandler(c.Value)
+	err := c.runCmd(nil, nil)
 	if err != nil {
 		return interop.GoErrToTErr(err), nil
 	}
@@ -46,6 +161,62 @@ func (c *ExecCmd) run(args ...tengo.Object) (tengo.Object, error) {
 	return nil, nil
 }
 
+// start starts the command in the background, returning a handle to the process. Since the script keeps
+// running, the lines passed to the stdout callback are queued and the callback is only run when the
+// script calls process.is_running() or process.wait(). Stdin isn't inherited unless it was set.
+// Represents 'cmd.start() ExecProcess|error'
+func (c *ExecCmd) start(args ...tengo.Object) (tengo.Object, error) {
+	var queue *interop.CallbackQueue
+	var onLine func(string) error
+	if c.onStdout != nil {
+		runner, err := interop.NewModuleFuncRunner(c.onStdout, c.module.getCompiled, c.module.ctx)
+		if err != nil {
+			c.closeFiles()
+			return interop.GoErrToTErr(err), nil
+		}
+
+		queue = interop.NewCallbackQueue(runner)
+		onLine = func(line string) error {
+			queue.Push(interop.GoStrToTStr(line))
+			return nil
+		}
+	}
+
+	// A background process reading the terminal would be stopped by SIGTTIN, as it runs in its own
+	// process group
+	if c.Value.Stdin == os.Stdin {
+		c.Value.Stdin = nil
+	}
+
+	finish := c.watchStdout(onLine)
+
+	process, err := startProcess(c.module, c.Value, c.timeout, queue, func(err error) error {
+		defer c.closeFiles()
+
+		callbackErr := finish()
+		if err == nil {
+			err = callbackErr
+		}
+		return err
+	})
+	if err != nil {
+		finish()
+		c.closeFiles()
+		return interop.GoErrToTErr(err), nil
+	}
+
+	return process, nil
+}
+
+// setOnStdout sets the function called with each line the command writes to stdout
+// Represents 'cmd.on_stdout(fn func(line string)) ExecCmd'
+func (c *ExecCmd) setOnStdout(args interop.ArgMap) (tengo.Object, error) {
+	fn, _ := args.GetCompiledFunc("fn")
+
+	c.onStdout = fn
+	return c, nil
+}
+
 func (c *ExecCmd) setStdin(args interop.ArgMap) (tengo.Object, error) {
 	file, _ := args.GetString("file")
 
@@ -54,13 +225,123 @@ func (c *ExecCmd) setStdin(args interop.ArgMap) (tengo.Object, error) {
 		return interop.GoErrToTErr(err), nil
 	}
 	c.Value.Stdin = f
+	c.addCloser(f)
 
 	return nil, nil
 }
 
-func makeExecCmd(cmd *exec.Cmd) *ExecCmd {
+// stdinString uses the string as the command's stdin
+// Represents 'cmd.stdin_string(data string) ExecCmd'
+func (c *ExecCmd) stdinString(args interop.ArgMap) (tengo.Object, error) {
+	data, _ := args.GetString("data")
+
+	c.Value.Stdin = strings.NewReader(data)
+	return c, nil
+}
+
+// stdoutFile redirects the command's stdout to the file, truncating it if it exists
+// Represents 'cmd.stdout_file(path string) ExecCmd|error'
+func (c *ExecCmd) stdoutFile(args interop.ArgMap) (tengo.Object, error) {
+	path, _ := args.GetString("path")
+
+	f, err := os.Create(path)
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+	c.Value.Stdout = f
+	c.addCloser(f)
+
+	return c, nil
+}
+
+// stderrFile redirects the command's stderr to the file, truncating it if it exists
+// Represents 'cmd.stderr_file(path string) ExecCmd|error'
+func (c *ExecCmd) stderrFile(args interop.ArgMap) (tengo.Object, error) {
+	path, _ := args.GetString("path")
+
+	f, err := os.Create(path)
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+	c.Value.Stderr = f
+	c.addCloser(f)
+
+	return c, nil
+}
+
+// env sets environment variables for the command. The variables are merged with the
+// current environment unless replace is true.
+// Represents 'cmd.env(vars map[string]string, replace bool?) ExecCmd'
+func (c *ExecCmd) env(args interop.ArgMap) (tengo.Object, error) {
+	vars, _ := args.GetStrMapStr("vars")
+	replace, _ := args.GetBool("replace")
+
+	var env []string
+	if !replace {
+		env = c.Value.Env
+		if env == nil {
+			env = os.Environ()
+		}
+	}
+
+	var keys []string
+	for key := range vars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		env = setEnvVar(env, key, vars[key])
+	}
+
+	if env == nil {
+		env = []string{}
+	}
+
+	c.Value.Env = env
+	return c, nil
+}
+
+// dir sets the working directory of the command
+// Represents 'cmd.dir(path string) ExecCmd'
+func (c *ExecCmd) dir(args interop.ArgMap) (tengo.Object, error) {
+	path, _ := args.GetString("path")
+
+	c.Value.Dir = path
+	return c, nil
+}
+
+// setTimeout sets the max duration the command can run before its process group is killed
+// Represents 'cmd.timeout(duration string) ExecCmd|error'
+func (c *ExecCmd) setTimeout(args interop.ArgMap) (tengo.Object, error) {
+	duration, _ := args.GetString("duration")
+
+	timeout, err := time.ParseDuration(duration)
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+
+	c.timeout = timeout
+	return c, nil
+}
+
+// setEnvVar replaces the variable in the environment slice or appends it if it doesn't exist
+func setEnvVar(env []string, key string, value string) []string {
+	prefix := key + "="
+	for i, v := range env {
+		if strings.HasPrefix(v, prefix) {
+			env[i] = prefix + value
+			return env
+		}
+	}
+
+	return append(env, prefix+value)
+}
+
+func makeExecCmd(m *module, cmd *exec.Cmd) *ExecCmd {
 	execCmd := &ExecCmd{
-		Value: cmd,
+		Value:  cmd,
+		module: m,
 	}
 
 	objectMap := map[string]tengo.Object{
@@ -68,12 +349,58 @@ func makeExecCmd(cmd *exec.Cmd) *ExecCmd {
 			Name:  "run",
 			Value: execCmd.run,
 		},
+		"start": &tengo.UserFunction{
+			Name:  "start",
+			Value: execCmd.start,
+		},
+		"on_stdout": &interop.AdvFunction{
+			Name:    "on_stdout",
+			NumArgs: interop.ExactArgs(1),
+			Args:    []interop.AdvArg{interop.CompileFuncArg("fn")},
+			Value:   execCmd.setOnStdout,
+		},
 		"set_stdin": &interop.AdvFunction{
 			Name:    "set_stdin",
 			NumArgs: interop.ExactArgs(1),
 			Args:    []interop.AdvArg{interop.StrArg("file")},
 			Value:   execCmd.setStdin,
 		},
+		"stdin_string": &interop.AdvFunction{
+			Name:    "stdin_string",
+			NumArgs: interop.ExactArgs(1),
+			Args:    []interop.AdvArg{interop.StrArg("data")},
+			Value:   execCmd.stdinString,
+		},
+		"stdout_file": &interop.AdvFunction{
+			Name:    "stdout_file",
+			NumArgs: interop.ExactArgs(1),
+			Args:    []interop.AdvArg{interop.StrArg("path")},
+			Value:   execCmd.stdoutFile,
+		},
+		"stderr_file": &interop.AdvFunction{
+			Name:    "stderr_file",
+			NumArgs: interop.ExactArgs(1),
+			Args:    []interop.AdvArg{interop.StrArg("path")},
+			Value:   execCmd.stderrFile,
+		},
+		"env": &interop.AdvFunction{
+			Name:    "env",
+			NumArgs: interop.ArgRange(1, 2),
+			Args:    []interop.AdvArg{interop.StrMapStrArg("vars"), interop.BoolArg("replace")},
+			Value:   execCmd.env,
+		},
+		"dir": &interop.AdvFunction{
+			Name:    "dir",
+			NumArgs: interop.ExactArgs(1),
+			Args:    []interop.AdvArg{interop.StrArg("path")},
+			Value:   execCmd.dir,
+		},
+		"timeout": &interop.AdvFunction{
+			Name:    "timeout",
+			NumArgs: interop.ExactArgs(1),
+			Args:    []interop.AdvArg{interop.StrArg("duration")},
+			Value:   execCmd.setTimeout,
+		},
 	}
 
 	execCmd.PropObject = types.PropObject{
@@ -0,0 +1,251 @@
+package exec
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/analog-substance/tengo/v2"
+	"github.com/analog-substance/tengomod/interop"
+)
+
+var ErrCanceled error = errors.New("command canceled")
+
+// parallelResult is the outcome of a single command run by parallel
+type parallelResult struct {
+	index    int
+	exitCode int
+	duration time.Duration
+	err      error
+}
+
+func (r parallelResult) failed() bool {
+	return r.err != nil || r.exitCode != 0
+}
+
+func (r parallelResult) toTengo() tengo.Object {
+	errObj := tengo.UndefinedValue
+	if r.err != nil {
+		errObj = interop.GoErrToTErr(r.err)
+	}
+
+	return &tengo.ImmutableMap{
+		Value: map[string]tengo.Object{
+			"index":     interop.GoIntToTInt(r.index),
+			"exit_code": interop.GoIntToTInt(r.exitCode),
+			"duration":  interop.GoStrToTStr(r.duration.String()),
+			"err":       errObj,
+		},
+	}
+}
+
+// parallelRunner runs commands with bounded concurrency
+type parallelRunner struct {
+	module      *module
+	cmds        []*ExecCmd
+	concurrency int
+	failFast    bool
+
+	mutex     sync.Mutex
+	cancelErr error
+	running   map[int]*ExecCmd
+
+	// callbackMutex makes the callbacks of the commands and on_done take turns
+	callbackMutex sync.Mutex
+}
+
+// cancel stops any new commands from starting and kills the running ones. The commands that are
+// killed or never started report err as their error.
+func (r *parallelRunner) cancel(err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.cancelErr != nil {
+		return
+	}
+
+	r.cancelErr = err
+	for _, c := range r.running {
+		c.Value.Process.Kill()
+	}
+}
+
+func (r *parallelRunner) canceled() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.cancelErr
+}
+
+func (r *parallelRunner) runOne(i int) parallelResult {
+	c := r.cmds[i]
+
+	if err := r.canceled(); err != nil {
+		c.closeFiles()
+		return parallelResult{index: i, exitCode: -1, err: err}
+	}
+
+	start := time.Now()
+	err := c.runCmd(func() {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		if r.cancelErr != nil {
+			c.Value.Process.Kill()
+			return
+		}
+		r.running[i] = c
+	}, &r.callbackMutex)
+
+	r.mutex.Lock()
+	delete(r.running, i)
+	r.mutex.Unlock()
+
+	if cancelErr := r.canceled(); cancelErr != nil && err == ErrSignaled {
+		err = cancelErr
+	}
+
+	result := parallelResult{
+		index:    i,
+		exitCode: c.exitCode(),
+		duration: time.Since(start),
+		err:      err,
+	}
+
+	// Cancel before the worker can pick up the next command
+	if r.failFast && result.failed() {
+		r.cancel(ErrCanceled)
+	}
+
+	return result
+}
+
+// Run runs the commands, calling onDone with each result as the commands complete.
+// The results are returned in the same order as the commands.
+func (r *parallelRunner) Run(onDone func(parallelResult) error) ([]parallelResult, error) {
+	r.running = make(map[int]*ExecCmd)
+
+	indexes := make(chan int)
+	results := make(chan parallelResult)
+
+	var wg sync.WaitGroup
+	for w := 0; w < r.concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results <- r.runOne(i)
+			}
+		}()
+	}
+
+	go func() {
+		for i := range r.cmds {
+			indexes <- i
+		}
+		close(indexes)
+
+		wg.Wait()
+		close(results)
+	}()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	done := r.module.ctx.Done()
+
+	var err error
+	ordered := make([]parallelResult, len(r.cmds))
+	for {
+		select {
+		case <-sigs:
+			r.cancel(ErrSignaled)
+		case <-done:
+			done = nil
+			r.cancel(ErrCanceled)
+		case result, ok := <-results:
+			if !ok {
+				return ordered, err
+			}
+
+			ordered[result.index] = result
+
+			if onDone != nil && err == nil {
+				r.callbackMutex.Lock()
+				err = onDone(result)
+				r.callbackMutex.Unlock()
+				if err != nil {
+					r.cancel(ErrCanceled)
+				}
+			}
+		}
+	}
+}
+
+// tengoParallel runs the commands with bounded concurrency
+// Represents 'exec.parallel(cmds []ExecCmd, options {concurrency: int, fail_fast: bool, on_done: func(result)}?) []result|error'
+func (m *module) tengoParallel(args interop.ArgMap) (tengo.Object, error) {
+	objs, _ := args.GetSlice("cmds")
+	options, _ := args.GetArgMap("options")
+
+	var cmds []*ExecCmd
+	for i, obj := range objs {
+		cmd, ok := obj.(*ExecCmd)
+		if !ok {
+			return nil, tengo.ErrInvalidArgumentType{
+				Name:     fmt.Sprintf("cmds[%d]", i),
+				Expected: "exec-cmd",
+				Found:    obj.(tengo.Object).TypeName(),
+			}
+		}
+
+		cmds = append(cmds, cmd)
+	}
+
+	concurrency, ok := options.GetInt("concurrency")
+	if !ok || concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
+
+	failFast, _ := options.GetBool("fail_fast")
+
+	runner := &parallelRunner{
+		module:      m,
+		cmds:        cmds,
+		concurrency: concurrency,
+		failFast:    failFast,
+	}
+
+	var onDone func(parallelResult) error
+	if fn, ok := options.GetCompiledFunc("on_done"); ok {
+		fnRunner, err := interop.NewModuleFuncRunner(fn, m.getCompiled, m.ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		onDone = func(result parallelResult) error {
+			_, err := fnRunner.Run(result.toTengo())
+			return err
+		}
+	}
+
+	results, err := runner.Run(onDone)
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+
+	var values []tengo.Object
+	for _, result := range results {
+		values = append(values, result.toTengo())
+	}
+
+	return &tengo.Array{
+		Value: values,
+	}, nil
+}
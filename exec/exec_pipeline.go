@@ -0,0 +1,190 @@
+package exec
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/analog-substance/tengo/v2"
+	"github.com/analog-substance/tengomod/interop"
+	"github.com/analog-substance/tengomod/types"
+)
+
+// ExecPipeline connects the stdout of each command to the stdin of the next
+type ExecPipeline struct {
+	types.PropObject
+	Value []*ExecCmd
+
+	exitCodes []int
+}
+
+// TypeName should return the name of the type.
+func (p *ExecPipeline) TypeName() string {
+	return "exec-pipeline"
+}
+
+// String should return a string representation of the type's value.
+func (p *ExecPipeline) String() string {
+	var stages []string
+	for _, c := range p.Value {
+		stages = append(stages, strings.Join(c.Value.Args, " "))
+	}
+
+	return fmt.Sprintf("<exec-pipeline>: %s", strings.Join(stages, " | "))
+}
+
+// IsFalsy should return true if the value of the type should be considered
+// as falsy.
+func (p *ExecPipeline) IsFalsy() bool {
+	return len(p.Value) == 0
+}
+
+// CanIterate should return whether the Object can be Iterated.
+func (p *ExecPipeline) CanIterate() bool {
+	return false
+}
+
+// timeout returns the smallest timeout set on any of the stages
+func (p *ExecPipeline) timeout() time.Duration {
+	var timeout time.Duration
+	for _, c := range p.Value {
+		if c.timeout > 0 && (timeout == 0 || c.timeout < timeout) {
+			timeout = c.timeout
+		}
+	}
+
+	return timeout
+}
+
+// Run runs all stages of the pipeline, returning the error of each stage
+func (p *ExecPipeline) Run() ([]error, error) {
+	var readers []*os.File
+	var writers []*os.File
+
+	defer func() {
+		for _, f := range append(readers, writers...) {
+			f.Close()
+		}
+
+		for _, c := range p.Value {
+			c.closeFiles()
+		}
+	}()
+
+	for i := 0; i < len(p.Value)-1; i++ {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return nil, err
+		}
+
+		readers = append(readers, r)
+		writers = append(writers, w)
+
+		p.Value[i].Value.Stdout = w
+		p.Value[i+1].Value.Stdin = r
+	}
+
+	// The stages run at the same time, so their stdout callbacks take turns
+	var callbackMutex sync.Mutex
+
+	var finishers []func() error
+	var cmds []*exec.Cmd
+	for _, c := range p.Value {
+		onLine, err := c.stdoutCallback(&callbackMutex)
+		if err != nil {
+			for _, f := range finishers {
+				f()
+			}
+			return nil, err
+		}
+
+		finishers = append(finishers, c.watchStdout(onLine))
+		cmds = append(cmds, c.Value)
+	}
+
+	// The started processes have their own copies of the pipes
+	onStarted := func() {
+		for _, r := range readers {
+			r.Close()
+		}
+	}
+
+	// Close the stage's end of the pipe so the next stage sees EOF
+	onExited := func(i int) {
+		if i < len(writers) {
+			writers[i].Close()
+		}
+	}
+
+	errs := runCmdsWithSigHandler(cmds, p.timeout(), onStarted, onExited)
+	for i, finish := range finishers {
+		callbackErr := finish()
+		if errs[i] == nil {
+			errs[i] = callbackErr
+		}
+	}
+
+	p.exitCodes = nil
+	for _, c := range p.Value {
+		p.exitCodes = append(p.exitCodes, c.exitCode())
+	}
+
+	return errs, nil
+}
+
+// run runs the pipeline. The error returned is ErrTimeout or ErrSignaled if any stage timed out or
+// was signaled, otherwise it is the error of the last stage that failed and was started.
+// Represents 'pipeline.run() error'
+func (p *ExecPipeline) run(args ...tengo.Object) (tengo.Object, error) {
+	errs, err := p.Run()
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+
+	for _, e := range []error{ErrTimeout, ErrSignaled} {
+		for _, stageErr := range errs {
+			if stageErr == e {
+				return interop.GoErrToTErr(e), nil
+			}
+		}
+	}
+
+	for i := len(errs) - 1; i >= 0; i-- {
+		if errs[i] != nil && errs[i] != ErrNotStarted {
+			return interop.GoErrToTErr(fmt.Errorf("stage %d: %v", i, errs[i])), nil
+		}
+	}
+
+	return nil, nil
+}
+
+func makeExecPipeline(cmds []*ExecCmd) *ExecPipeline {
+	pipeline := &ExecPipeline{
+		Value: cmds,
+	}
+
+	objectMap := map[string]tengo.Object{
+		"run": &tengo.UserFunction{
+			Name:  "run",
+			Value: pipeline.run,
+		},
+	}
+
+	properties := map[string]types.Property{
+		"exit_codes": {
+			Get: func() tengo.Object {
+				return interop.GoIntSliceToTArray(pipeline.exitCodes)
+			},
+		},
+	}
+
+	pipeline.PropObject = types.PropObject{
+		ObjectMap:  objectMap,
+		Properties: properties,
+	}
+
+	return pipeline
+}
@@ -0,0 +1,254 @@
+package exec
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/analog-substance/tengo/v2"
+	"github.com/analog-substance/tengomod/interop"
+	"github.com/analog-substance/tengomod/types"
+)
+
+// ExecProcess is a handle to a command started in the background
+type ExecProcess struct {
+	types.PropObject
+	Value *exec.Cmd
+
+	done      chan struct{}
+	err       error
+	mutex     sync.Mutex
+	callbacks *interop.CallbackQueue
+}
+
+// TypeName should return the name of the type.
+func (p *ExecProcess) TypeName() string {
+	return "exec-process"
+}
+
+// String should return a string representation of the type's value.
+func (p *ExecProcess) String() string {
+	return fmt.Sprintf("<exec-process>: %d", p.Value.Process.Pid)
+}
+
+// IsFalsy should return true if the value of the type should be considered
+// as falsy.
+func (p *ExecProcess) IsFalsy() bool {
+	return p.Value == nil
+}
+
+// CanIterate should return whether the Object can be Iterated.
+func (p *ExecProcess) CanIterate() bool {
+	return false
+}
+
+func (p *ExecProcess) isRunning() bool {
+	select {
+	case <-p.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// kill kills the process group of the process
+func (p *ExecProcess) kill() error {
+	if !p.isRunning() {
+		return nil
+	}
+
+	return killProcessGroup(p.Value)
+}
+
+// flushCallbacks runs the stdout callback with the lines queued so far
+func (p *ExecProcess) flushCallbacks() error {
+	if p.callbacks == nil {
+		return nil
+	}
+
+	return p.callbacks.Flush()
+}
+
+// Wait blocks until the process exits and returns its error. The queued stdout callbacks are run before
+// returning, so Wait must be called from the script's goroutine.
+func (p *ExecProcess) Wait() error {
+	<-p.done
+
+	p.mutex.Lock()
+	err := p.err
+	p.mutex.Unlock()
+
+	callbackErr := p.flushCallbacks()
+	if err == nil {
+		err = callbackErr
+	}
+
+	return err
+}
+
+func (p *ExecProcess) exitCode() int {
+	if p.isRunning() {
+		return -1
+	}
+
+	return p.Value.ProcessState.ExitCode()
+}
+
+// wait blocks until the process exits
+// Represents 'process.wait() error'
+func (p *ExecProcess) wait(args ...tengo.Object) (tengo.Object, error) {
+	err := p.Wait()
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+
+	return nil, nil
+}
+
+// signal sends the named signal to the process
+// Represents 'process.signal(name string) error'
+func (p *ExecProcess) signal(args interop.ArgMap) (tengo.Object, error) {
+	name, _ := args.GetString("name")
+
+	name = strings.ToUpper(name)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+
+	sig, ok := signals[name]
+	if !ok {
+		return interop.GoErrToTErr(fmt.Errorf("unsupported signal: %s", name)), nil
+	}
+
+	if !p.isRunning() {
+		return nil, nil
+	}
+
+	err := p.Value.Process.Signal(sig)
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+
+	return nil, nil
+}
+
+// tengoKill kills the process
+// Represents 'process.kill() error'
+func (p *ExecProcess) tengoKill(args ...tengo.Object) (tengo.Object, error) {
+	err := p.kill()
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+
+	return nil, nil
+}
+
+// startProcess starts the command in its own process group in the background. The process group is killed
+// if the timeout expires. finish is called once the command exits with the command's error. The stdout
+// callbacks queued to callbacks are run by the process's Wait.
+func startProcess(m *module, cmd *exec.Cmd, timeout time.Duration, callbacks *interop.CallbackQueue, finish func(error) error) (*ExecProcess, error) {
+	setProcessGroup(cmd)
+
+	err := cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	process := &ExecProcess{
+		Value:     cmd,
+		done:      make(chan struct{}),
+		callbacks: callbacks,
+	}
+
+	m.track(process)
+
+	var timedOut atomic.Bool
+	var timer *time.Timer
+	if timeout > 0 {
+		timer = time.AfterFunc(timeout, func() {
+			// Stored before killing so Wait can't see the kill's exit first
+			timedOut.Store(true)
+			process.kill()
+		})
+	}
+
+	go func() {
+		err := cmd.Wait()
+		if timer != nil {
+			timer.Stop()
+		}
+
+		signaled := false
+		if exiterr, ok := err.(*exec.ExitError); ok {
+			if status, ok := exiterr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+				signaled = true
+				err = ErrSignaled
+			}
+		}
+
+		// The timer may fire after the process exited on its own, which is only a timeout if the kill
+		// is what ended the process
+		if signaled && timedOut.Load() {
+			err = ErrTimeout
+		}
+
+		err = finish(err)
+
+		process.mutex.Lock()
+		process.err = err
+		process.mutex.Unlock()
+
+		m.untrack(process)
+		close(process.done)
+	}()
+
+	objectMap := map[string]tengo.Object{
+		"wait": &tengo.UserFunction{
+			Name:  "wait",
+			Value: process.wait,
+		},
+		"signal": &interop.AdvFunction{
+			Name:    "signal",
+			NumArgs: interop.ExactArgs(1),
+			Args:    []interop.AdvArg{interop.StrArg("name")},
+			Value:   process.signal,
+		},
+		"kill": &tengo.UserFunction{
+			Name:  "kill",
+			Value: process.tengoKill,
+		},
+		"is_running": &tengo.UserFunction{
+			Name: "is_running",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				running := process.isRunning()
+
+				err := process.flushCallbacks()
+				if err != nil {
+					return interop.GoErrToTErr(err), nil
+				}
+
+				return interop.GoBoolToTBool(running), nil
+			},
+		},
+	}
+
+	properties := map[string]types.Property{
+		"pid": types.StaticProperty(interop.GoIntToTInt(cmd.Process.Pid)),
+		"exit_code": {
+			Get: func() tengo.Object {
+				return interop.GoIntToTInt(process.exitCode())
+			},
+		},
+	}
+
+	process.PropObject = types.PropObject{
+		ObjectMap:  objectMap,
+		Properties: properties,
+	}
+
+	return process, nil
+}
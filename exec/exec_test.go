@@ -0,0 +1,222 @@
+package exec_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/analog-substance/tengo/v2"
+	"github.com/analog-substance/tengo/v2/require"
+	"github.com/analog-substance/tengomod"
+	"github.com/analog-substance/tengomod/exec"
+	"github.com/analog-substance/tengomod/internal/test"
+	"github.com/analog-substance/tengomod/interop"
+)
+
+func TestExecCmd(t *testing.T) {
+	rootTempDir := t.TempDir()
+
+	stdoutFile := filepath.Join(rootTempDir, "stdout.txt")
+	test.Module(t, "exec").Call("cmd", "sh", "-c", `echo "$EXEC_TEST:$(pwd)"; cat`).
+		Call("env", test.MAP{"EXEC_TEST": "value"}).
+		Call("dir", rootTempDir).
+		Call("stdin_string", "stdin data").
+		Call("stdout_file", stdoutFile).
+		Call("run").ExpectNil()
+
+	bytes, err := os.ReadFile(stdoutFile)
+	require.NoError(t, err)
+	require.Equal(t, "value:"+rootTempDir+"\nstdin data", string(bytes))
+
+	stderrFile := filepath.Join(rootTempDir, "stderr.txt")
+	test.Module(t, "exec").Call("cmd", "sh", "-c", `echo "${HOME:-unset}" >&2`).
+		Call("env", test.MAP{}, true).
+		Call("stderr_file", stderrFile).
+		Call("run").ExpectNil()
+
+	bytes, err = os.ReadFile(stderrFile)
+	require.NoError(t, err)
+	require.Equal(t, "unset\n", string(bytes))
+
+	test.Module(t, "exec").Call("cmd", "sleep", "5").Call("timeout", "not a duration").ExpectTengoError()
+	test.Module(t, "exec").Call("cmd", "sleep", "5").
+		Call("timeout", "100ms").
+		Call("run").Expect(interop.GoErrToTErr(exec.ErrTimeout))
+
+	// Commands reading from a character device stay in the foreground process group and are killed alone
+	cmd := test.Module(t, "exec").Call("cmd", "sleep", "5")
+	cmd.Call("set_stdin", os.DevNull)
+	cmd.Call("timeout", "100ms").Call("run").Expect(interop.GoErrToTErr(exec.ErrTimeout))
+
+	test.Module(t, "exec").Call("cmd", "true").Call("stdout_file", filepath.Join(rootTempDir, "nonexistent", "out.txt")).ExpectTengoError()
+}
+
+func TestExecProcess(t *testing.T) {
+	process := test.Module(t, "exec").Call("cmd", "sleep", "5").Call("start")
+	process.Call("is_running").Expect(true)
+	process.Call("signal", "bogus").ExpectTengoError()
+	process.Call("kill").ExpectNil()
+	process.Call("wait").Expect(interop.GoErrToTErr(exec.ErrSignaled))
+	process.Call("is_running").Expect(false)
+
+	process = test.Module(t, "exec").Call("cmd", "sh", "-c", "exit 3").Call("start")
+	process.Call("wait").ExpectTengoError()
+	process.Get("exit_code").Expect(3)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	process = test.Module(t, "exec", tengomod.WithContext(ctx)).Call("cmd", "sleep", "5").Call("start")
+	cancel()
+	process.Call("wait").Expect(interop.GoErrToTErr(exec.ErrSignaled))
+
+	outFile := filepath.Join(t.TempDir(), "out.txt")
+	compiled := test.RunScript(t, fmt.Sprintf(`
+exec := import("exec")
+lines := []
+err := exec.cmd("printf", "line1\nline2\n").stdout_file(%q).on_stdout(func(line) {
+	lines = append(lines, line)
+}).start().wait()
+`, outFile))
+	require.Nil(t, compiled.Get("err").Value())
+	require.Equal(t, test.Object(test.ARR{"line1", "line2"}), compiled.Get("lines").Object())
+
+	bytes, err := os.ReadFile(outFile)
+	require.NoError(t, err)
+	require.Equal(t, "line1\nline2\n", string(bytes))
+
+	// The callback updates the globals while the script keeps running
+	compiled = test.RunScript(t, fmt.Sprintf(`
+exec := import("exec")
+lines := []
+process := exec.cmd("sh", "-c", "for i in 1 2 3; do echo $i; sleep 0.05; done").stdout_file(%q).on_stdout(func(line) {
+	lines = append(lines, line)
+}).start()
+busy := 0
+for i := 0; i < 100000; i++ {
+	busy += len(lines)
+}
+err := process.wait()
+`, outFile))
+	require.Nil(t, compiled.Get("err").Value())
+	require.Equal(t, test.Object(test.ARR{"1", "2", "3"}), compiled.Get("lines").Object())
+
+	// Background processes don't read the terminal
+	test.Module(t, "exec").Call("cmd", "cat").Call("timeout", "2s").Call("start").Call("wait").ExpectNil()
+	for i := 0; i < 20; i++ {
+		test.Module(t, "exec").Call("cmd", "sleep", "5").Call("timeout", "10ms").Call("start").Call("wait").
+			Expect(interop.GoErrToTErr(exec.ErrTimeout))
+	}
+
+	// Processes started once the context is done are killed
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	process = test.Module(t, "exec", tengomod.WithContext(ctx)).Call("cmd", "sleep", "5").Call("start")
+	process.Call("wait").Expect(interop.GoErrToTErr(exec.ErrSignaled))
+
+}
+
+func TestExecPipeline(t *testing.T) {
+	outFile := filepath.Join(t.TempDir(), "out.txt")
+
+	execModule := test.Module(t, "exec")
+	pipeline := execModule.Call("pipeline",
+		execModule.Call("cmd", "printf", "foo\nbar\nbaz\n").Obj,
+		execModule.Call("cmd", "grep", "ba").Obj,
+		execModule.Call("cmd", "sort", "-r").Call("stdout_file", outFile).Obj,
+	)
+	pipeline.Call("run").ExpectNil()
+	pipeline.Get("exit_codes").Expect([]int{0, 0, 0})
+
+	bytes, err := os.ReadFile(outFile)
+	require.NoError(t, err)
+	require.Equal(t, "baz\nbar\n", string(bytes))
+
+	pipeline = execModule.Call("pipeline",
+		execModule.Call("cmd", "sh", "-c", "echo foo; exit 2").Obj,
+		execModule.Call("cmd", "cat").Call("stdout_file", outFile).Obj,
+	)
+	pipeline.Call("run").ExpectNil()
+	pipeline.Get("exit_codes").Expect([]int{2, 0})
+
+	// yes is killed by SIGPIPE once head exits, which isn't a signal sent to the pipeline
+	pipeline = execModule.Call("pipeline",
+		execModule.Call("cmd", "yes").Obj,
+		execModule.Call("cmd", "head", "-1").Call("stdout_file", outFile).Obj,
+	)
+	pipeline.Call("run").ExpectNil()
+	pipeline.Get("exit_codes").Expect([]int{-1, 0})
+
+	bytes, err = os.ReadFile(outFile)
+	require.NoError(t, err)
+	require.Equal(t, "y\n", string(bytes))
+
+	// The stages after one that fails to start are never run
+	pipeline = execModule.Call("pipeline",
+		execModule.Call("cmd", "printf", "foo").Obj,
+		execModule.Call("cmd", "nonexistent-binary-for-tests").Obj,
+		execModule.Call("cmd", "cat").Call("stdout_file", outFile).Obj,
+	)
+	errs, err := pipeline.Obj.(*exec.ExecPipeline).Run()
+	require.NoError(t, err)
+	require.Error(t, errs[1])
+	require.Equal(t, exec.ErrNotStarted, errs[2])
+
+	execModule.Call("pipeline", "not a cmd").ExpectError()
+}
+
+func TestExecParallel(t *testing.T) {
+	compiled := test.RunScript(t, `
+exec := import("exec")
+done := []
+results := exec.parallel([
+	exec.cmd("sh", "-c", "sleep 0.2; exit 1"),
+	exec.cmd("true"),
+	exec.cmd("sh", "-c", "exit 3")
+], {concurrency: 2, on_done: func(result) {
+	done = append(done, result.index)
+}})
+
+codes := []
+for r in results {
+	codes = append(codes, r.exit_code)
+}
+`)
+	require.Equal(t, test.Object(test.ARR{1, 0, 3}), compiled.Get("codes").Object())
+	require.Equal(t, 3, len(compiled.Get("done").Array()))
+
+	compiled = test.RunScript(t, `
+exec := import("exec")
+results := exec.parallel([
+	exec.cmd("sh", "-c", "exit 1"),
+	exec.cmd("sleep", "5"),
+	exec.cmd("true")
+], {concurrency: 2, fail_fast: true})
+
+first := results[0].exit_code
+canceled := string(results[1].err) == string(exec.err_canceled) && string(results[2].err) == string(exec.err_canceled)
+`)
+	require.Equal(t, int64(1), compiled.Get("first").Int64())
+	require.True(t, compiled.Get("canceled").Bool())
+
+	execModule := test.Module(t, "exec")
+	execModule.Call("parallel", []interface{}{"not a cmd"}).ExpectError()
+}
+
+func TestExecTools(t *testing.T) {
+	execModule := test.Module(t, "exec")
+	require.IsType(t, &tengo.String{}, execModule.Call("look_path", "sh").Obj)
+	execModule.Call("look_path", "not-a-real-binary").ExpectTengoError()
+
+	compiled := test.RunScript(t, `
+exec := import("exec")
+path := exec.require("sh", {min_version: "1.2", version_args: ["-c", "echo version 1.10.0-dev"], version_regex: "version (\\S+)"})
+old := exec.require("sh", {min_version: "2.0", version_args: ["-c", "echo version 1.10.0"], version_regex: "version (\\S+)"})
+missing := exec.require("not-a-real-binary")
+reasons := [old.value.reason, old.value.version, missing.value.reason]
+report := len(exec.tools())
+`)
+	require.True(t, compiled.Get("path").String() != "")
+	require.Equal(t, test.Object(test.ARR{"too_old", "1.10.0", "not_found"}), compiled.Get("reasons").Object())
+	require.Equal(t, 2, compiled.Get("report").Int())
+}
@@ -0,0 +1,243 @@
+package exec
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/analog-substance/tengo/v2"
+	"github.com/analog-substance/tengomod/interop"
+)
+
+const (
+	ToolNotFound       string = "not_found"
+	ToolVersionUnknown string = "version_unknown"
+	ToolTooOld         string = "too_old"
+)
+
+var defaultVersionRegex = regexp.MustCompile(`(\d+(?:\.\d+)+)`)
+
+// versionTimeout is how long to wait for a binary to report its version
+var versionTimeout = 10 * time.Second
+
+// Tool describes an external binary and the minimum version required
+type Tool struct {
+	Name         string
+	MinVersion   string
+	VersionArgs  []string
+	VersionRegex *regexp.Regexp
+}
+
+// Tools are the external binaries used by the ffuf and nmap modules
+var Tools []Tool = []Tool{
+	{
+		Name:         "ffuf",
+		MinVersion:   "1.3.0",
+		VersionArgs:  []string{"-V"},
+		VersionRegex: regexp.MustCompile(`ffuf version:\s*v?(\d+(?:\.\d+)+)`),
+	},
+	{
+		Name:         "nmap",
+		MinVersion:   "7.0",
+		VersionArgs:  []string{"--version"},
+		VersionRegex: regexp.MustCompile(`Nmap version (\d+(?:\.\d+)+)`),
+	},
+}
+
+// ToolError is returned when a tool is missing or doesn't satisfy the minimum version
+type ToolError struct {
+	Name       string
+	Path       string
+	Version    string
+	MinVersion string
+	Reason     string
+}
+
+func (e *ToolError) Error() string {
+	switch e.Reason {
+	case ToolNotFound:
+		return fmt.Sprintf("%s: executable not found in $PATH", e.Name)
+	case ToolVersionUnknown:
+		return fmt.Sprintf("%s: unable to determine version of %s", e.Name, e.Path)
+	case ToolTooOld:
+		return fmt.Sprintf("%s: version %s is older than the required %s", e.Name, e.Version, e.MinVersion)
+	}
+
+	return fmt.Sprintf("%s: %s", e.Name, e.Reason)
+}
+
+// toTengo converts the error to a tengo error with the fields of the error as its value
+func (e *ToolError) toTengo() tengo.Object {
+	return &tengo.Error{
+		Value: &tengo.ImmutableMap{
+			Value: map[string]tengo.Object{
+				"name":        interop.GoStrToTStr(e.Name),
+				"path":        interop.GoStrToTStr(e.Path),
+				"version":     interop.GoStrToTStr(e.Version),
+				"min_version": interop.GoStrToTStr(e.MinVersion),
+				"reason":      interop.GoStrToTStr(e.Reason),
+				"message":     interop.GoStrToTStr(e.Error()),
+			},
+		},
+	}
+}
+
+// Require looks up the tool's path and checks that its version is at least the minimum version.
+// The version of the tool is only checked if a minimum version is set.
+func Require(tool Tool) (path string, version string, err error) {
+	path, err = exec.LookPath(tool.Name)
+	if err != nil {
+		return "", "", &ToolError{Name: tool.Name, MinVersion: tool.MinVersion, Reason: ToolNotFound}
+	}
+
+	if tool.MinVersion == "" {
+		return path, "", nil
+	}
+
+	version = toolVersion(path, tool)
+	if version == "" {
+		return path, "", &ToolError{Name: tool.Name, Path: path, MinVersion: tool.MinVersion, Reason: ToolVersionUnknown}
+	}
+
+	if compareVersions(version, tool.MinVersion) < 0 {
+		return path, version, &ToolError{
+			Name:       tool.Name,
+			Path:       path,
+			Version:    version,
+			MinVersion: tool.MinVersion,
+			Reason:     ToolTooOld,
+		}
+	}
+
+	return path, version, nil
+}
+
+// toolVersion runs the tool with its version args and extracts the version from the output
+func toolVersion(path string, tool Tool) string {
+	args := tool.VersionArgs
+	if len(args) == 0 {
+		args = []string{"--version"}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), versionTimeout)
+	defer cancel()
+
+	// Some tools exit non-zero when printing their version, so only the output matters
+	output, _ := exec.CommandContext(ctx, path, args...).CombinedOutput()
+
+	re := tool.VersionRegex
+	if re == nil {
+		re = defaultVersionRegex
+	}
+
+	match := re.FindSubmatch(output)
+	if match == nil {
+		return ""
+	}
+
+	if len(match) > 1 {
+		return string(match[1])
+	}
+	return string(match[0])
+}
+
+// compareVersions compares the dotted numeric versions, returning -1, 0 or 1. Anything after
+// the numeric part of a version component, like '-dev', is ignored.
+func compareVersions(a string, b string) int {
+	aParts := strings.Split(a, ".")
+	bParts := strings.Split(b, ".")
+
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		aNum := versionPart(aParts, i)
+		bNum := versionPart(bParts, i)
+
+		if aNum < bNum {
+			return -1
+		} else if aNum > bNum {
+			return 1
+		}
+	}
+
+	return 0
+}
+
+func versionPart(parts []string, i int) int {
+	if i >= len(parts) {
+		return 0
+	}
+
+	part := parts[i]
+	end := 0
+	for end < len(part) && part[end] >= '0' && part[end] <= '9' {
+		end++
+	}
+
+	num, _ := strconv.Atoi(part[:end])
+	return num
+}
+
+// tengoLookPath searches for the executable in the directories named by the PATH environment variable
+// Represents 'exec.look_path(name string) string|error'
+func tengoLookPath(args interop.ArgMap) (tengo.Object, error) {
+	name, _ := args.GetString("name")
+
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+
+	return interop.GoStrToTStr(path), nil
+}
+
+// tengoRequire checks that the executable exists and satisfies the minimum version
+// Represents 'exec.require(name string, options {min_version: string, version_args: []string, version_regex: string}?) string|error'
+func tengoRequire(args interop.ArgMap) (tengo.Object, error) {
+	name, _ := args.GetString("name")
+	options, _ := args.GetArgMap("options")
+
+	tool := Tool{
+		Name: name,
+	}
+	tool.MinVersion, _ = options.GetString("min_version")
+	tool.VersionArgs, _ = options.GetStringSlice("version_args")
+	tool.VersionRegex, _ = options.GetRegex("version_regex")
+
+	path, _, err := Require(tool)
+	if err != nil {
+		return err.(*ToolError).toTengo(), nil
+	}
+
+	return interop.GoStrToTStr(path), nil
+}
+
+// tengoTools checks all external binaries used by the ffuf and nmap modules
+// Represents 'exec.tools() map[string]{path: string, version: string, min_version: string, ok: bool, err: error}'
+func tengoTools(args ...tengo.Object) (tengo.Object, error) {
+	report := make(map[string]tengo.Object)
+	for _, tool := range Tools {
+		path, version, err := Require(tool)
+
+		errObj := tengo.UndefinedValue
+		if err != nil {
+			errObj = err.(*ToolError).toTengo()
+		}
+
+		report[tool.Name] = &tengo.ImmutableMap{
+			Value: map[string]tengo.Object{
+				"path":        interop.GoStrToTStr(path),
+				"version":     interop.GoStrToTStr(version),
+				"min_version": interop.GoStrToTStr(tool.MinVersion),
+				"ok":          interop.GoBoolToTBool(err == nil),
+				"err":         errObj,
+			},
+		}
+	}
+
+	return &tengo.ImmutableMap{
+		Value: report,
+	}, nil
+}
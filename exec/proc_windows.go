@@ -0,0 +1,26 @@
+//go:build windows
+
+package exec
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// signals maps the supported signal names to their values
+var signals = map[string]syscall.Signal{
+	"SIGINT":  syscall.SIGINT,
+	"SIGKILL": syscall.SIGKILL,
+}
+
+// setProcessGroup is a no-op on windows
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills the process since process groups aren't supported on windows
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+
+	return cmd.Process.Kill()
+}
@@ -0,0 +1,210 @@
+package ffuf
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	ffuf "github.com/analog-substance/ffufwrap"
+	"github.com/analog-substance/tengo/v2"
+	modexec "github.com/analog-substance/tengomod/exec"
+	"github.com/analog-substance/tengomod/interop"
+)
+
+const defaultCampaignConcurrency int = 4
+
+var unsafeFileCharsRegex = regexp.MustCompile(`[^\w.-]+`)
+
+// CampaignResult is the result of fuzzing a single target of a campaign
+type CampaignResult struct {
+	Target     string
+	OutputFile string
+	Output     *Output
+	Err        error
+}
+
+func (r CampaignResult) toTengo() tengo.Object {
+	results := tengo.UndefinedValue
+	if r.Output != nil {
+		results = makeResults(r.Output)
+	}
+
+	errObj := tengo.UndefinedValue
+	if r.Err != nil {
+		errObj = interop.GoErrToTErr(r.Err)
+	}
+
+	return &tengo.ImmutableMap{
+		Value: map[string]tengo.Object{
+			"target":      interop.GoStrToTStr(r.Target),
+			"output_file": interop.GoStrToTStr(r.OutputFile),
+			"results":     results,
+			"err":         errObj,
+		},
+	}
+}
+
+// setTarget sets the URL fuzzed by the fuzzer. The FUZZ keyword is appended to the path when the
+// target doesn't contain it.
+func setTarget(fuzzer *Fuzzer, target string) {
+	fuzzer.SetTarget(target)
+	if !strings.Contains(target, "FUZZ") {
+		fuzzer.AutoAppendKeyword()
+	}
+}
+
+// campaignOutputFile returns the path of the target's output file in the output directory
+func campaignOutputFile(outputDir string, i int, target string) string {
+	name := target
+	if u, err := url.Parse(target); err == nil && u.Host != "" {
+		name = u.Host
+	}
+
+	name = strings.Trim(unsafeFileCharsRegex.ReplaceAllString(name, "_"), "_")
+	return filepath.Join(outputDir, fmt.Sprintf("%04d-%s.json", i, name))
+}
+
+// Campaign fuzzes each target with a clone of the fuzzer, running up to concurrency fuzzers at once.
+// The global rate is split between the concurrent fuzzers, running no more fuzzers than requests per
+// second, and each target's JSON output is written to the output directory. The result callbacks of
+// the fuzzers take turns. No more targets are started once a run is interrupted by a signal.
+func (f *Fuzzer) Campaign(targets []string, concurrency int, globalRate int, outputDir string) ([]CampaignResult, error) {
+	err := os.MkdirAll(outputDir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	if concurrency > len(targets) {
+		concurrency = len(targets)
+	}
+
+	rate := 0
+	if globalRate > 0 {
+		concurrency = min(concurrency, globalRate)
+		rate = globalRate / max(concurrency, 1)
+	}
+
+	var callbackMutex sync.Mutex
+
+	results := make([]CampaignResult, len(targets))
+
+	var signaled sync.Once
+	stop := make(chan struct{})
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fuzzer := f.Clone()
+				fuzzer.callbackMutex = &callbackMutex
+				setTarget(fuzzer, targets[i])
+				if rate > 0 {
+					fuzzer.Value.RequestRate(rate)
+				}
+
+				fuzzer.outputFile = campaignOutputFile(outputDir, i, targets[i])
+				fuzzer.Value.OutputFile(fuzzer.outputFile).OutputFormat(ffuf.FormatJSON)
+
+				output, err := fuzzer.Run()
+				results[i] = CampaignResult{
+					Target:     targets[i],
+					OutputFile: fuzzer.outputFile,
+					Output:     output,
+					Err:        err,
+				}
+
+				if err == modexec.ErrSignaled {
+					signaled.Do(func() {
+						close(stop)
+					})
+				}
+			}
+		}()
+	}
+
+	started := len(targets)
+dispatch:
+	for i := range targets {
+		select {
+		case indexes <- i:
+		case <-stop:
+			started = i
+			break dispatch
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	for i := started; i < len(targets); i++ {
+		results[i] = CampaignResult{
+			Target: targets[i],
+			Err:    modexec.ErrSignaled,
+		}
+	}
+
+	return results, nil
+}
+
+// tengoCampaign fuzzes each target with a clone of the fuzzer. Without an output directory, the outputs
+// are written to a temporary one that is removed before returning, so no output files are returned.
+// Represents 'ffuf.campaign(fuzzer Fuzzer, targets []string, options {concurrency: int, global_rate: int, output_dir: string}?) {results: []result, targets: []{target: string, output_file: string, results: Results|undefined, err: error|undefined}}|error'
+func tengoCampaign(args interop.ArgMap) (tengo.Object, error) {
+	obj, _ := args.GetObject("fuzzer")
+	targets, _ := args.GetStringSlice("targets")
+	options, _ := args.GetArgMap("options")
+
+	fuzzer := obj.(*Fuzzer)
+
+	concurrency, ok := options.GetInt("concurrency")
+	if !ok || concurrency <= 0 {
+		concurrency = defaultCampaignConcurrency
+	}
+
+	globalRate, _ := options.GetInt("global_rate")
+
+	outputDir, hasOutputDir := options.GetString("output_dir")
+	if !hasOutputDir {
+		tempDir, err := os.MkdirTemp("", "ffuf-campaign-")
+		if err != nil {
+			return interop.GoErrToTErr(err), nil
+		}
+		defer os.RemoveAll(tempDir)
+
+		outputDir = tempDir
+	}
+
+	results, err := fuzzer.Campaign(targets, concurrency, globalRate, outputDir)
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+
+	var all []tengo.Object
+	var targetResults []tengo.Object
+	for _, result := range results {
+		if !hasOutputDir {
+			result.OutputFile = ""
+		}
+
+		if result.Output != nil {
+			for _, r := range result.Output.Results {
+				all = append(all, r.toTengo())
+			}
+		}
+
+		targetResults = append(targetResults, result.toTengo())
+	}
+
+	return &tengo.ImmutableMap{
+		Value: map[string]tengo.Object{
+			"results": &tengo.ImmutableArray{Value: all},
+			"targets": &tengo.ImmutableArray{Value: targetResults},
+		},
+	}, nil
+}
@@ -0,0 +1,325 @@
+package ffuf
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const defaultThreads int = 40
+
+var (
+	progressRegex = regexp.MustCompile(`Progress: \[(\d+)/(\d+)\]`)
+	keywordRegex  = regexp.MustCompile(`^[A-Z0-9]+$`)
+
+	// checkpointMutex serializes updates to checkpoint files shared by concurrent runs
+	checkpointMutex sync.Mutex
+)
+
+// Checkpoint is the progress of a fuzzer configuration saved in a checkpoint file
+type Checkpoint struct {
+	Offset    int      `json:"offset"`
+	Completed bool     `json:"completed"`
+	Results   []Result `json:"results"`
+}
+
+// fuzzerArgs are the parsed arguments of an ffuf command relevant to checkpoints
+type fuzzerArgs struct {
+	wordlists   []int
+	mode        string
+	threads     int
+	extensions  int
+	recursion   bool
+	quiet       bool
+	calibration bool
+}
+
+func parseFuzzerArgs(args []string) fuzzerArgs {
+	parsed := fuzzerArgs{
+		mode:    "clusterbomb",
+		threads: defaultThreads,
+	}
+
+	for i := 0; i < len(args); i++ {
+		hasValue := i+1 < len(args)
+		switch args[i] {
+		case "-w":
+			if hasValue {
+				parsed.wordlists = append(parsed.wordlists, i+1)
+			}
+		case "-mode":
+			if hasValue {
+				parsed.mode = args[i+1]
+			}
+		case "-t":
+			if hasValue {
+				if threads, err := strconv.Atoi(args[i+1]); err == nil {
+					parsed.threads = threads
+				}
+			}
+		case "-e":
+			if hasValue {
+				parsed.extensions = len(strings.Split(args[i+1], ","))
+			}
+		case "-recursion":
+			parsed.recursion = true
+		case "-s", "-silent", "-json":
+			parsed.quiet = true
+		case "-ac", "-acc", "-ach", "-acs":
+			parsed.calibration = true
+		}
+	}
+
+	return parsed
+}
+
+// splitWordlistArg splits the value of -w into the path and the keyword suffix. Like ffuf, the suffix
+// is only a keyword when it is uppercase alphanumeric, so paths containing colons are kept whole.
+func splitWordlistArg(arg string) (string, string) {
+	i := strings.LastIndex(arg, ":")
+	if i == -1 || !keywordRegex.MatchString(arg[i+1:]) {
+		return arg, ""
+	}
+	return arg[:i], arg[i:]
+}
+
+// checkpointKey identifies the fuzzer configuration of the command's arguments. Output arguments are
+// ignored and wordlists are identified by their content, so temporary wordlists match between runs.
+func checkpointKey(args []string) (string, error) {
+	hash := sha256.New()
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-o", "-of":
+			i++
+			continue
+		case "-json":
+			continue
+		case "-w":
+			if i+1 < len(args) {
+				path, keyword := splitWordlistArg(args[i+1])
+				content, err := os.ReadFile(path)
+				if err != nil {
+					return "", err
+				}
+
+				contentHash := sha256.Sum256(content)
+				fmt.Fprintf(hash, "-w\x00%x%s\x00", contentHash, keyword)
+				i++
+				continue
+			}
+		}
+
+		fmt.Fprintf(hash, "%s\x00", args[i])
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func readCheckpoints(path string) (map[string]*Checkpoint, error) {
+	checkpoints := make(map[string]*Checkpoint)
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return checkpoints, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(content, &checkpoints)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint file %s: %v", path, err)
+	}
+
+	return checkpoints, nil
+}
+
+// LoadCheckpoint returns the checkpoint of the configuration in the checkpoint file
+func LoadCheckpoint(path string, key string) (*Checkpoint, error) {
+	checkpointMutex.Lock()
+	defer checkpointMutex.Unlock()
+
+	checkpoints, err := readCheckpoints(path)
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoint, ok := checkpoints[key]
+	if !ok {
+		return &Checkpoint{}, nil
+	}
+
+	return checkpoint, nil
+}
+
+// SaveCheckpoint saves the checkpoint of the configuration to the checkpoint file
+func SaveCheckpoint(path string, key string, checkpoint *Checkpoint) error {
+	checkpointMutex.Lock()
+	defer checkpointMutex.Unlock()
+
+	checkpoints, err := readCheckpoints(path)
+	if err != nil {
+		return err
+	}
+
+	checkpoints[key] = checkpoint
+
+	content, err := json.MarshalIndent(checkpoints, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, content, 0644)
+}
+
+// skipWords writes a copy of the wordlist without its first n lines to a temporary file
+func skipWords(path string, n int) (string, error) {
+	lines, err := readLines(path)
+	if err != nil {
+		return "", err
+	}
+
+	lines = lines[min(n, len(lines)):]
+
+	file, err := os.CreateTemp("", "ffuf-resume-*.txt")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	_, err = file.WriteString(strings.Join(lines, "\n") + "\n")
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+
+	return file.Name(), nil
+}
+
+// resumeRun tracks the progress of a run resuming from a checkpoint
+type resumeRun struct {
+	path       string
+	key        string
+	args       fuzzerArgs
+	checkpoint *Checkpoint
+	tempFiles  []string
+}
+
+// newResumeRun loads the checkpoint of the command's configuration. The wordlists must be linear,
+// meaning each request uses the next line of the wordlists, so the completed requests can be skipped.
+// The completed requests are counted from ffuf's progress output, so it must not be suppressed.
+func newResumeRun(path string, cmd *exec.Cmd) (*resumeRun, error) {
+	args := parseFuzzerArgs(cmd.Args[1:])
+	if args.recursion {
+		return nil, errors.New("resume is not supported with recursion")
+	}
+
+	if args.calibration {
+		return nil, errors.New("resume is not supported with auto-calibration, as its requests are counted in ffuf's progress output")
+	}
+
+	if args.quiet {
+		return nil, errors.New("resume is not supported with on_result, silent or print_json, as they suppress ffuf's progress output")
+	}
+
+	if len(args.wordlists) > 1 && args.mode != "pitchfork" {
+		return nil, errors.New("resume requires a single wordlist or the pitchfork mode")
+	}
+
+	if args.mode == "sniper" {
+		return nil, errors.New("resume is not supported with the sniper mode")
+	}
+
+	key, err := checkpointKey(cmd.Args[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoint, err := LoadCheckpoint(path, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resumeRun{
+		path:       path,
+		key:        key,
+		args:       args,
+		checkpoint: checkpoint,
+	}, nil
+}
+
+// skipCompleted replaces the command's wordlists with copies skipping the completed words
+func (r *resumeRun) skipCompleted(cmd *exec.Cmd) error {
+	if r.checkpoint.Offset == 0 {
+		return nil
+	}
+
+	for _, i := range r.args.wordlists {
+		path, keyword := splitWordlistArg(cmd.Args[i+1])
+
+		tempFile, err := skipWords(path, r.checkpoint.Offset)
+		if err != nil {
+			return err
+		}
+		r.tempFiles = append(r.tempFiles, tempFile)
+
+		cmd.Args[i+1] = tempFile + keyword
+	}
+
+	return nil
+}
+
+// cleanup removes the wordlist copies
+func (r *resumeRun) cleanup() {
+	for _, tempFile := range r.tempFiles {
+		os.Remove(tempFile)
+	}
+}
+
+// completedWords returns the number of words completed according to the last progress printed by ffuf.
+// Requests still in flight might have completed out of order, so a request per thread is discounted.
+func (r *resumeRun) completedWords(stderr string) int {
+	matches := progressRegex.FindAllStringSubmatch(stderr, -1)
+	if len(matches) == 0 {
+		return 0
+	}
+
+	requests, _ := strconv.Atoi(matches[len(matches)-1][1])
+	return max(requests-r.args.threads, 0) / (r.args.extensions + 1)
+}
+
+// save merges the output with the results of the previous runs and saves the checkpoint. When the
+// run didn't complete, the results of words that will be tested again are dropped.
+func (r *resumeRun) save(output *Output, stderr string, completed bool) error {
+	perWord := r.args.extensions + 1
+	words := r.completedWords(stderr)
+
+	results := append([]Result{}, r.checkpoint.Results...)
+	for _, result := range output.Results {
+		if !completed && (result.Position-1)/perWord >= words {
+			continue
+		}
+
+		result.Position += r.checkpoint.Offset * perWord
+		results = append(results, result)
+	}
+	output.Results = results
+
+	r.checkpoint.Results = results
+	r.checkpoint.Completed = completed
+	if !completed {
+		r.checkpoint.Offset += words
+	}
+
+	return SaveCheckpoint(r.path, r.key, r.checkpoint)
+}
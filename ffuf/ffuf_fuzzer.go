@@ -4,17 +4,20 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	ffuf "github.com/analog-substance/ffufwrap"
 	"github.com/analog-substance/tengo/v2"
-	"github.com/analog-substance/tengo/v2/stdlib"
 	tengojson "github.com/analog-substance/tengo/v2/stdlib/json"
 	modexec "github.com/analog-substance/tengomod/exec"
+	modhttp "github.com/analog-substance/tengomod/http"
 	"github.com/analog-substance/tengomod/interop"
 	"github.com/analog-substance/tengomod/types"
 	"github.com/analog-substance/util/fileutil"
@@ -25,9 +28,18 @@ type Fuzzer struct {
 	types.PropObject
 	Value *ffuf.Fuzzer
 
-	context         context.Context
+	module          *module
 	addJSONWarnings bool
 	outputFile      string
+	onResult        *tengo.CompiledFunction
+	wordlists       []*Wordlist
+	checkpointFile  string
+	native          *modhttp.HTTPClient
+	url             string
+	appendKeyword   bool
+
+	// callbackMutex makes the result callbacks of a campaign's fuzzers take turns
+	callbackMutex *sync.Mutex
 }
 
 func (f *Fuzzer) TypeName() string {
@@ -36,7 +48,7 @@ func (f *Fuzzer) TypeName() string {
 
 // String should return a string representation of the type's value.
 func (f *Fuzzer) String() string {
-	return strings.Join(f.Value.Args(), " ")
+	return strings.Join(f.build(f.module.ctx).Args(), " ")
 }
 
 // IsFalsy should return true if the value of the type should be considered
@@ -201,13 +213,106 @@ func (f *Fuzzer) customArguments(args interop.ArgMap) (tengo.Object, error) {
 	return f, nil
 }
 
-func (f *Fuzzer) clone(args ...tengo.Object) (tengo.Object, error) {
-	fuzzer := makeFfufFuzzer(f.context, f.Value.Clone(f.context))
+// Clone copies the fuzzer to create a new one
+func (f *Fuzzer) Clone() *Fuzzer {
+	fuzzer := makeFfufFuzzer(f.module, f.Value.Clone(f.module.ctx))
 
 	fuzzer.addJSONWarnings = f.addJSONWarnings
 	fuzzer.outputFile = f.outputFile
+	fuzzer.onResult = f.onResult
+	fuzzer.wordlists = append(fuzzer.wordlists, f.wordlists...)
+	fuzzer.checkpointFile = f.checkpointFile
+	fuzzer.native = f.native
+	fuzzer.url = f.url
+	fuzzer.appendKeyword = f.appendKeyword
+
+	return fuzzer
+}
+
+func (f *Fuzzer) clone(args ...tengo.Object) (tengo.Object, error) {
+	return f.Clone(), nil
+}
+
+// target sets the URL to fuzz, which is passed with -u when the command is built
+// Represents 'fuzzer.target(url string) Fuzzer'
+func (f *Fuzzer) target(args interop.ArgMap) (tengo.Object, error) {
+	url, _ := args.GetString("url")
+
+	f.SetTarget(url)
+	return f, nil
+}
+
+// SetTarget sets the URL to fuzz
+func (f *Fuzzer) SetTarget(url string) {
+	f.url = url
+	f.Value.Target(url)
+}
+
+// AutoAppendKeyword appends the FUZZ keyword to the target URL's path when it doesn't contain it
+func (f *Fuzzer) AutoAppendKeyword() *ffuf.Fuzzer {
+	f.appendKeyword = true
+	return f.Value.AutoAppendKeyword()
+}
+
+// build copies the ffufwrap fuzzer, passing the target URL with -u. ffufwrap only passes the target
+// itself when it appends the FUZZ keyword to it.
+func (f *Fuzzer) build(ctx context.Context) *ffuf.Fuzzer {
+	fuzzer := f.Value.Clone(ctx)
+	if f.url == "" || (f.appendKeyword && !strings.Contains(f.url, "FUZZ")) {
+		return fuzzer
+	}
+
+	return fuzzer.CustomArguments("-u", f.url)
+}
+
+// args returns the arguments passed to ffuf
+// Represents 'fuzzer.args() []string'
+func (f *Fuzzer) args(args ...tengo.Object) (tengo.Object, error) {
+	return interop.GoStrSliceToTArray(f.build(f.module.ctx).Args()), nil
+}
 
-	return fuzzer, nil
+// wordlist adds the wordlist file or Wordlist, optionally with the keyword it replaces
+// Represents 'fuzzer.wordlist(wordlist string|Wordlist, keyword string?) Fuzzer'
+func (f *Fuzzer) wordlist(args interop.ArgMap) (tengo.Object, error) {
+	value, _ := args.Get("wordlist")
+	keyword, hasKeyword := args.GetString("keyword")
+
+	var path string
+	switch wordlist := value.(type) {
+	case *Wordlist:
+		path = wordlist.path
+		f.wordlists = append(f.wordlists, wordlist)
+	case string:
+		path = wordlist
+	}
+
+	if hasKeyword {
+		path += ":" + keyword
+	}
+
+	f.Value.Wordlist(path)
+	return f, nil
+}
+
+// acquireWordlists writes the files of the fuzzer's wordlists, returning the function removing them
+func (f *Fuzzer) acquireWordlists() (func(), error) {
+	var acquired []*Wordlist
+	release := func() {
+		for _, wordlist := range acquired {
+			wordlist.release()
+		}
+	}
+
+	for _, wordlist := range f.wordlists {
+		err := wordlist.acquire()
+		if err != nil {
+			release()
+			return nil, err
+		}
+		acquired = append(acquired, wordlist)
+	}
+
+	return release, nil
 }
 
 func (f *Fuzzer) tengoOutputFile(args interop.ArgMap) (tengo.Object, error) {
@@ -218,15 +323,77 @@ func (f *Fuzzer) tengoOutputFile(args interop.ArgMap) (tengo.Object, error) {
 	return f, nil
 }
 
+// resume sets the checkpoint file tracking the completed words of each fuzzer configuration. Runs skip
+// the words completed by previous runs and return their results merged with the previous ones. The
+// completed words are estimated from ffuf's progress output, discounting a request per thread, so a few
+// words may be tested again. Runs fail when on_result, silent or print_json suppress the progress
+// output, or when auto-calibration adds requests to it.
+// Represents 'fuzzer.resume(checkpoint_path string) Fuzzer'
+func (f *Fuzzer) resume(args interop.ArgMap) (tengo.Object, error) {
+	path, _ := args.GetString("checkpoint_path")
+
+	f.checkpointFile = path
+	return f, nil
+}
+
+// setOnResult sets the function called with each result as ffuf finds it
+// Represents 'fuzzer.on_result(fn func(result) bool?) Fuzzer'
+func (f *Fuzzer) setOnResult(args interop.ArgMap) (tengo.Object, error) {
+	fn, _ := args.GetCompiledFunc("fn")
+
+	f.onResult = fn
+	return f, nil
+}
+
 func (f *Fuzzer) tengoAddJSONWarnings(args ...tengo.Object) (tengo.Object, error) {
 	f.addJSONWarnings = true
 	return f, nil
 }
 
-func (f *Fuzzer) run(args ...tengo.Object) (tengo.Object, error) {
-	cmd, err := f.Value.BuildCmd()
+// Run runs ffuf, returning the output parsed from its JSON output file. When no output file is set,
+// a temporary one is used. When ffuf is interrupted by a signal, the output is returned along with
+// exec.ErrSignaled. Native fuzzers send the requests in process instead of running ffuf.
+func (f *Fuzzer) Run() (*Output, error) {
+	releaseWordlists, err := f.acquireWordlists()
 	if err != nil {
-		return interop.GoErrToTErr(err), nil
+		return nil, err
+	}
+	defer releaseWordlists()
+
+	ctx, cancel := context.WithCancel(f.module.ctx)
+	defer cancel()
+
+	if f.native != nil {
+		return f.runNative(ctx)
+	}
+
+	fuzzer := f.build(ctx)
+	outputFile := f.outputFile
+	if outputFile == "" {
+		tempFile, err := os.CreateTemp("", "ffuf-*.json")
+		if err != nil {
+			return nil, err
+		}
+		tempFile.Close()
+		defer os.Remove(tempFile.Name())
+
+		outputFile = tempFile.Name()
+		fuzzer.OutputFile(outputFile).OutputFormat(ffuf.FormatJSON)
+	}
+
+	if f.onResult != nil {
+		fuzzer.PrintJSON()
+	}
+
+	cmd, err := fuzzer.BuildCmd()
+	if err != nil {
+		return nil, err
+	}
+
+	problems := ValidateArgs(cmd.Args[1:])
+	err = problemsError(problems)
+	if err != nil {
+		return nil, err
 	}
 
 	if cmd.Stdout == nil {
@@ -244,26 +411,95 @@ func (f *Fuzzer) run(args ...tengo.Object) (tengo.Object, error) {
 		cmd.Stderr = io.MultiWriter(errBuf, cmd.Stderr)
 	}
 
+	var resume *resumeRun
+	if f.checkpointFile != "" {
+		resume, err = newResumeRun(f.checkpointFile, cmd)
+		if err != nil {
+			return nil, err
+		}
+
+		if resume.checkpoint.Completed {
+			return &Output{Results: resume.checkpoint.Results}, nil
+		}
+
+		defer resume.cleanup()
+		err = resume.skipCompleted(cmd)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var stopped atomic.Bool
+	finish, err := f.watchResults(cmd, func() {
+		stopped.Store(true)
+		cancel()
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	err = modexec.RunCmdWithSigHandler(cmd)
+	callbackErr := finish()
+	if callbackErr != nil {
+		return nil, callbackErr
+	}
+
+	// ffuf exits with an error when it is interrupted
+	if stopped.Load() {
+		err = nil
+	}
+
 	signaled := err == modexec.ErrSignaled
 	if err != nil && !signaled {
-		return interop.GoErrToTErr(fmt.Errorf("%v: %s", err, errBuf.String())), nil
+		return nil, fmt.Errorf("%v: %s", err, errBuf.String())
 	}
 
-	err = f.processOutput(errBuf.String())
+	output, err := f.processOutput(outputFile, errBuf.String())
 	if err != nil {
-		return interop.GoErrToTErr(err), nil
+		return nil, err
+	}
+
+	for _, problem := range problems {
+		output.Warnings = append(output.Warnings, problem.String())
+	}
+
+	if resume != nil {
+		err = resume.save(output, errBuf.String(), !signaled && !stopped.Load())
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	if signaled {
-		return interop.GoErrToTErr(modexec.ErrSignaled), nil
+		return output, modexec.ErrSignaled
 	}
 
-	return nil, nil
+	return output, nil
+}
+
+// run runs ffuf, returning the results parsed from its JSON output
+// Represents 'fuzzer.run() Results|error'
+func (f *Fuzzer) run(args ...tengo.Object) (tengo.Object, error) {
+	output, err := f.Run()
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+
+	return makeResults(output), nil
 }
 
 func (f *Fuzzer) runWithOutput(args ...tengo.Object) (tengo.Object, error) {
-	cmd, err := f.Value.BuildCmd()
+	if f.native != nil {
+		return interop.GoErrToTErr(errors.New("run_with_output is not supported by the native fuzzer")), nil
+	}
+
+	releaseWordlists, err := f.acquireWordlists()
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+	defer releaseWordlists()
+
+	cmd, err := f.build(f.module.ctx).BuildCmd()
 	if err != nil {
 		return interop.GoErrToTErr(err), nil
 	}
@@ -291,9 +527,11 @@ func (f *Fuzzer) runWithOutput(args ...tengo.Object) (tengo.Object, error) {
 		return interop.GoErrToTErr(fmt.Errorf("%v: %s", err, errBuf.String())), nil
 	}
 
-	err = f.processOutput(errBuf.String())
-	if err != nil {
-		return interop.GoErrToTErr(err), nil
+	if f.outputFile != "" {
+		_, err = f.processOutput(f.outputFile, errBuf.String())
+		if err != nil {
+			return interop.GoErrToTErr(err), nil
+		}
 	}
 
 	return interop.GoStrToTStr(outBuf.String()), nil
@@ -313,49 +551,52 @@ func (f *Fuzzer) processStderr(stderr string) []string {
 	return nil
 }
 
-func (f *Fuzzer) processOutput(stderr string) error {
-	if f.outputFile == "" {
-		return nil
+// processOutput parses the JSON output file, adding the warnings from stderr. The warnings are
+// also written to the output file set by the user when add_json_warnings was called.
+func (f *Fuzzer) processOutput(outputFile string, stderr string) (*Output, error) {
+	output, err := ParseOutputFile(outputFile)
+	if err != nil {
+		return nil, err
 	}
+	output.Warnings = append(output.Warnings, f.processStderr(stderr)...)
 
-	bytes, err := os.ReadFile(f.outputFile)
+	if outputFile != f.outputFile || !f.addJSONWarnings || len(output.Warnings) == 0 {
+		return output, nil
+	}
+
+	bytes, err := os.ReadFile(outputFile)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	m := orderedmap.New()
 	err = json.Unmarshal(bytes, &m)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if f.addJSONWarnings {
-		warnings := f.processStderr(stderr)
-		if len(warnings) > 0 {
-			m.Set("warnings", warnings)
-		}
-	}
+	m.Set("warnings", output.Warnings)
 
 	bytes, err = json.MarshalIndent(&m, "", "  ")
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	err = fileutil.WriteString(f.outputFile, string(bytes))
+	err = fileutil.WriteString(outputFile, string(bytes))
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	return output, nil
 }
 
 func (f *Fuzzer) aliasFunc(name string, src string) *tengo.UserFunction {
 	return interop.AliasFunc(f, name, src)
 }
 
-func makeFfufFuzzer(ctx context.Context, f *ffuf.Fuzzer) *Fuzzer {
+func makeFfufFuzzer(m *module, f *ffuf.Fuzzer) *Fuzzer {
 	fuzzer := &Fuzzer{
-		Value:   f,
-		context: ctx,
+		Value:  f,
+		module: m,
 	}
 
 	objectMap := map[string]tengo.Object{
@@ -369,7 +610,7 @@ func makeFfufFuzzer(ctx context.Context, f *ffuf.Fuzzer) *Fuzzer {
 		},
 		"auto_append_keyword": &tengo.UserFunction{
 			Name:  "auto_append_keyword",
-			Value: fuzzer.funcARF(f.AutoAppendKeyword),
+			Value: fuzzer.funcARF(fuzzer.AutoAppendKeyword),
 		},
 		"headers": &tengo.UserFunction{
 			Name:  "headers",
@@ -580,9 +821,11 @@ func makeFfufFuzzer(ctx context.Context, f *ffuf.Fuzzer) *Fuzzer {
 			Args:    []interop.AdvArg{interop.ObjectArg("body")},
 			Value:   fuzzer.postJSON,
 		},
-		"target": &tengo.UserFunction{
-			Name:  "target",
-			Value: fuzzer.funcASRF(f.Target),
+		"target": &interop.AdvFunction{
+			Name:    "target",
+			NumArgs: interop.ExactArgs(1),
+			Args:    []interop.AdvArg{interop.StrArg("url")},
+			Value:   fuzzer.target,
 		},
 		"user_agent": &tengo.UserFunction{
 			Name:  "user_agent",
@@ -638,9 +881,14 @@ func makeFfufFuzzer(ctx context.Context, f *ffuf.Fuzzer) *Fuzzer {
 			Name:  "raw_request_protocol",
 			Value: fuzzer.funcASRF(f.RawRequestProtocol),
 		},
-		"wordlist": &tengo.UserFunction{
-			Name:  "wordlist",
-			Value: fuzzer.funcASRF(f.Wordlist),
+		"wordlist": &interop.AdvFunction{
+			Name:    "wordlist",
+			NumArgs: interop.ArgRange(1, 2),
+			Args: []interop.AdvArg{
+				interop.UnionArg("wordlist", interop.CustomType(&Wordlist{}), interop.StrType),
+				interop.StrArg("keyword"),
+			},
+			Value: fuzzer.wordlist,
 		},
 		"debug_log": &tengo.UserFunction{
 			Name:  "debug_log",
@@ -673,7 +921,7 @@ func makeFfufFuzzer(ctx context.Context, f *ffuf.Fuzzer) *Fuzzer {
 		},
 		"args": &tengo.UserFunction{
 			Name:  "args",
-			Value: stdlib.FuncARSs(f.Args),
+			Value: fuzzer.args,
 		},
 		"run": &tengo.UserFunction{
 			Name:  "run",
@@ -683,6 +931,22 @@ func makeFfufFuzzer(ctx context.Context, f *ffuf.Fuzzer) *Fuzzer {
 			Name:  "run_with_output",
 			Value: fuzzer.runWithOutput,
 		},
+		"on_result": &interop.AdvFunction{
+			Name:    "on_result",
+			NumArgs: interop.ExactArgs(1),
+			Args:    []interop.AdvArg{interop.CompileFuncArg("fn")},
+			Value:   fuzzer.setOnResult,
+		},
+		"resume": &interop.AdvFunction{
+			Name:    "resume",
+			NumArgs: interop.ExactArgs(1),
+			Args:    []interop.AdvArg{interop.StrArg("checkpoint_path")},
+			Value:   fuzzer.resume,
+		},
+		"validate": &tengo.UserFunction{
+			Name:  "validate",
+			Value: fuzzer.validate,
+		},
 		"add_json_warnings": &tengo.UserFunction{
 			Name:  "add_json_warnings",
 			Value: fuzzer.tengoAddJSONWarnings,
@@ -698,7 +962,3 @@ func makeFfufFuzzer(ctx context.Context, f *ffuf.Fuzzer) *Fuzzer {
 
 	return fuzzer
 }
-
-func newFfufFuzzer(ctx context.Context) *Fuzzer {
-	return makeFfufFuzzer(ctx, ffuf.NewFuzzer(ctx))
-}
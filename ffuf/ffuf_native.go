@@ -0,0 +1,799 @@
+package ffuf
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	ffuf "github.com/analog-substance/ffufwrap"
+	"github.com/analog-substance/tengo/v2"
+	modexec "github.com/analog-substance/tengomod/exec"
+	modhttp "github.com/analog-substance/tengomod/http"
+	"github.com/analog-substance/tengomod/interop"
+)
+
+const (
+	defaultNativeTimeout int    = 10
+	defaultMatchCodes    string = "200-299,301,302,307,401,403,405,500"
+
+	// sniperMarker surrounds the positions replaced one at a time in the sniper mode
+	sniperMarker string = "§"
+)
+
+var (
+	// nativeFlags are the ffuf flags implemented by the native fuzzer
+	nativeFlags []string = []string{
+		"-u", "-w", "-H", "-X", "-d", "-b", "-mc", "-ml", "-mr", "-ms", "-mw", "-fc", "-fl", "-fr", "-fs", "-fw",
+		"-mmode", "-fmode", "-t", "-rate", "-mode", "-timeout", "-r", "-e", "-ic", "-o", "-of",
+	}
+
+	// ignoredNativeFlags only change ffuf's terminal output, so they have no effect on the native fuzzer
+	ignoredNativeFlags []string = []string{"-c", "-json", "-noninteractive", "-s", "-silent", "-v"}
+
+	sniperRegex = regexp.MustCompile(sniperMarker + `([^` + sniperMarker + `]*)` + sniperMarker)
+)
+
+// nativeWordlist is a wordlist loaded by the native fuzzer along with the keyword it replaces
+type nativeWordlist struct {
+	keyword string
+	words   []string
+}
+
+// rangeMatcher matches integers against ffuf's comma separated list of values and ranges
+type rangeMatcher struct {
+	all    bool
+	ranges [][2]int
+}
+
+func parseRangeMatcher(value string) (*rangeMatcher, error) {
+	m := &rangeMatcher{}
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "all" {
+			m.all = true
+			continue
+		}
+
+		low, high, isRange := strings.Cut(part, "-")
+		if !isRange {
+			high = low
+		}
+
+		start, err := strconv.Atoi(low)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %s", part)
+		}
+
+		end, err := strconv.Atoi(high)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %s", part)
+		}
+
+		m.ranges = append(m.ranges, [2]int{start, end})
+	}
+
+	return m, nil
+}
+
+func (m *rangeMatcher) match(n int) bool {
+	if m.all {
+		return true
+	}
+
+	for _, r := range m.ranges {
+		if n >= r[0] && n <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// nativeResponse is the response to a request made by the native fuzzer
+type nativeResponse struct {
+	status  int
+	headers string
+	body    string
+	words   int
+	lines   int
+}
+
+// responseMatcher checks a property of a response
+type responseMatcher func(r *nativeResponse) bool
+
+// parseResponseMatcher creates the matcher checking the response property of the matcher or filter flag
+func parseResponseMatcher(flag string, value string) (responseMatcher, error) {
+	if flag[2] == 'r' {
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", flag, err)
+		}
+
+		return func(r *nativeResponse) bool {
+			return re.MatchString(r.headers + r.body)
+		}, nil
+	}
+
+	m, err := parseRangeMatcher(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", flag, err)
+	}
+
+	switch flag[2] {
+	case 'c':
+		return func(r *nativeResponse) bool {
+			return m.match(r.status)
+		}, nil
+	case 's':
+		return func(r *nativeResponse) bool {
+			return m.match(len(r.body))
+		}, nil
+	case 'w':
+		return func(r *nativeResponse) bool {
+			return m.match(r.words)
+		}, nil
+	default:
+		return func(r *nativeResponse) bool {
+			return m.match(r.lines)
+		}, nil
+	}
+}
+
+// nativeInput is the keyword values of a single request. In the sniper mode, position is the index of the
+// marker replaced by the word.
+type nativeInput struct {
+	values   map[string]string
+	position int
+}
+
+// nativeConfig is the fuzzer configuration parsed from ffuf's arguments
+type nativeConfig struct {
+	args       []string
+	url        string
+	method     string
+	headers    []string
+	body       string
+	cookie     string
+	wordlists  []nativeWordlist
+	extensions []string
+	mode       string
+	threads    int
+	rate       int
+	timeout    int
+	redirects  bool
+	matchers   []responseMatcher
+	filters    []responseMatcher
+	matchAnd   bool
+	filterAnd  bool
+	outputFile string
+}
+
+// parseNativeConfig parses the ffuf arguments supported by the native fuzzer, returning an error for any
+// other flag
+func parseNativeConfig(args []string) (*nativeConfig, error) {
+	flags := parseFlags(args)
+
+	var unsupported []string
+	for flag := range flags {
+		if !slices.Contains(nativeFlags, flag) && !slices.Contains(ignoredNativeFlags, flag) {
+			unsupported = append(unsupported, flag)
+		}
+	}
+
+	if len(unsupported) != 0 {
+		sort.Strings(unsupported)
+		return nil, fmt.Errorf("options not supported by the native fuzzer: %s", strings.Join(unsupported, ", "))
+	}
+
+	config := &nativeConfig{
+		args:     args,
+		mode:     string(ffuf.ModeClusterBomb),
+		threads:  defaultThreads,
+		timeout:  defaultNativeTimeout,
+		headers:  flags["-H"],
+		matchAnd: lastFlagIs(flags, "-mmode", string(ffuf.AndOperator)),
+	}
+	config.filterAnd = lastFlagIs(flags, "-fmode", string(ffuf.AndOperator))
+	config.url, _ = lastFlag(flags, "-u")
+	config.body, _ = lastFlag(flags, "-d")
+	config.cookie, _ = lastFlag(flags, "-b")
+	config.outputFile, _ = lastFlag(flags, "-o")
+	_, config.redirects = flags["-r"]
+
+	if mode, ok := lastFlag(flags, "-mode"); ok {
+		config.mode = mode
+	}
+
+	config.method = http.MethodGet
+	if _, ok := flags["-d"]; ok {
+		config.method = http.MethodPost
+	}
+	if method, ok := lastFlag(flags, "-X"); ok {
+		config.method = method
+	}
+
+	if format, ok := lastFlag(flags, "-of"); ok && format != string(ffuf.FormatJSON) {
+		return nil, fmt.Errorf("-of: output format %s is not supported by the native fuzzer", format)
+	}
+
+	for _, flag := range []struct {
+		name  string
+		value *int
+	}{
+		{"-t", &config.threads},
+		{"-rate", &config.rate},
+		{"-timeout", &config.timeout},
+	} {
+		value, ok := lastFlag(flags, flag.name)
+		if !ok {
+			continue
+		}
+
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid number %s", flag.name, value)
+		}
+		*flag.value = n
+	}
+
+	if extensions, ok := lastFlag(flags, "-e"); ok {
+		for _, ext := range strings.Split(extensions, ",") {
+			if ext = strings.TrimSpace(ext); ext != "" {
+				config.extensions = append(config.extensions, ext)
+			}
+		}
+	}
+
+	_, ignoreComments := flags["-ic"]
+	for _, arg := range flags["-w"] {
+		path, keyword := splitWordlistArg(arg)
+		keyword = strings.TrimPrefix(keyword, ":")
+		if keyword == "" {
+			keyword = defaultKeyword
+		}
+
+		lines, err := readLines(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var words []string
+		for _, line := range lines {
+			if ignoreComments && strings.HasPrefix(line, "#") {
+				continue
+			}
+			words = append(words, line)
+		}
+
+		config.wordlists = append(config.wordlists, nativeWordlist{
+			keyword: keyword,
+			words:   words,
+		})
+	}
+
+	// Without any matcher, ffuf matches the default status codes
+	if !slices.ContainsFunc(matchers, func(flag string) bool { return len(flags[flag]) != 0 }) {
+		flags["-mc"] = []string{defaultMatchCodes}
+	}
+
+	for _, flag := range append(append([]string{}, matchers...), filters...) {
+		value, ok := lastFlag(flags, flag)
+		if !ok {
+			continue
+		}
+
+		m, err := parseResponseMatcher(flag, value)
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.HasPrefix(flag, "-m") {
+			config.matchers = append(config.matchers, m)
+		} else {
+			config.filters = append(config.filters, m)
+		}
+	}
+
+	return config, nil
+}
+
+func lastFlagIs(flags map[string][]string, name string, value string) bool {
+	last, _ := lastFlag(flags, name)
+	return last == value
+}
+
+// wordValues returns the values tested for the word. Extensions are only added to the FUZZ keyword.
+func (c *nativeConfig) wordValues(keyword string, word string) []string {
+	values := []string{word}
+	if keyword != defaultKeyword {
+		return values
+	}
+
+	for _, ext := range c.extensions {
+		values = append(values, word+ext)
+	}
+	return values
+}
+
+// generate calls yield with each input of the wordlist mode, stopping when it returns false
+func (c *nativeConfig) generate(yield func(nativeInput) bool) {
+	switch c.mode {
+	case string(ffuf.ModeSniper):
+		positions := 0
+		for _, part := range c.templates() {
+			positions += len(sniperRegex.FindAllStringIndex(part, -1))
+		}
+
+		wordlist := c.wordlists[0]
+		for position := 0; position < positions; position++ {
+			for _, word := range wordlist.words {
+				for _, value := range c.wordValues(wordlist.keyword, word) {
+					if !yield(nativeInput{values: map[string]string{wordlist.keyword: value}, position: position}) {
+						return
+					}
+				}
+			}
+		}
+	case string(ffuf.ModePitchFork):
+		n := -1
+		for _, wordlist := range c.wordlists {
+			if n == -1 || len(wordlist.words) < n {
+				n = len(wordlist.words)
+			}
+		}
+
+		for i := 0; i < n; i++ {
+			values := make(map[string]string)
+			for _, wordlist := range c.wordlists {
+				values[wordlist.keyword] = wordlist.words[i]
+			}
+
+			if !c.yieldExtensions(values, yield) {
+				return
+			}
+		}
+	default:
+		c.clusterbomb(0, make(map[string]string), yield)
+	}
+}
+
+// clusterbomb yields every combination of the words of the wordlists from index i, with the last
+// wordlist changing the fastest
+func (c *nativeConfig) clusterbomb(i int, values map[string]string, yield func(nativeInput) bool) bool {
+	if i == len(c.wordlists) {
+		input := make(map[string]string)
+		for keyword, value := range values {
+			input[keyword] = value
+		}
+		return c.yieldExtensions(input, yield)
+	}
+
+	wordlist := c.wordlists[i]
+	for _, word := range wordlist.words {
+		values[wordlist.keyword] = word
+		if !c.clusterbomb(i+1, values, yield) {
+			return false
+		}
+	}
+	return true
+}
+
+// yieldExtensions yields the values along with a copy for each extension appended to the FUZZ keyword
+func (c *nativeConfig) yieldExtensions(values map[string]string, yield func(nativeInput) bool) bool {
+	word, ok := values[defaultKeyword]
+	if !ok {
+		return yield(nativeInput{values: values})
+	}
+
+	for _, value := range c.wordValues(defaultKeyword, word) {
+		input := make(map[string]string)
+		for keyword, v := range values {
+			input[keyword] = v
+		}
+		input[defaultKeyword] = value
+
+		if !yield(nativeInput{values: input}) {
+			return false
+		}
+	}
+	return true
+}
+
+// templates returns the parts of the request the keywords are replaced in, in the order of the sniper
+// mode's positions
+func (c *nativeConfig) templates() []string {
+	return append([]string{c.url, c.method, c.body, c.cookie}, c.headers...)
+}
+
+// fill replaces the keywords of the input in the templates
+func (c *nativeConfig) fill(input nativeInput) []string {
+	templates := c.templates()
+	if c.mode == string(ffuf.ModeSniper) {
+		word := input.values[c.wordlists[0].keyword]
+		position := 0
+		for i, template := range templates {
+			templates[i] = sniperRegex.ReplaceAllStringFunc(template, func(marked string) string {
+				position++
+				if position-1 == input.position {
+					return word
+				}
+				return strings.Trim(marked, sniperMarker)
+			})
+		}
+		return templates
+	}
+
+	for i, template := range templates {
+		for keyword, value := range input.values {
+			template = strings.ReplaceAll(template, keyword, value)
+		}
+		templates[i] = template
+	}
+	return templates
+}
+
+func (c *nativeConfig) isMatch(r *nativeResponse) bool {
+	matched := false
+	for _, m := range c.matchers {
+		if m(r) {
+			matched = true
+			if !c.matchAnd {
+				break
+			}
+		} else if c.matchAnd {
+			return false
+		}
+	}
+
+	if !matched || len(c.filters) == 0 {
+		return matched
+	}
+
+	filtered := c.filterAnd
+	for _, f := range c.filters {
+		if c.filterAnd {
+			filtered = filtered && f(r)
+		} else if f(r) {
+			filtered = true
+			break
+		}
+	}
+
+	return !filtered
+}
+
+// nativeEngine sends the fuzzer's requests in process using the http module's client
+type nativeEngine struct {
+	config   *nativeConfig
+	client   *modhttp.HTTPClient
+	onResult func(Result) error
+	throttle <-chan time.Time
+}
+
+// newNativeEngine creates the engine sending the requests with a clone of the client, which keeps its
+// retry policy, limits and cookie jar but uses the fuzzer's timeout and redirect policy
+func newNativeEngine(config *nativeConfig, client *modhttp.HTTPClient, onResult func(Result) error) *nativeEngine {
+	client = client.Clone()
+	client.Value.Timeout = time.Duration(config.timeout) * time.Second
+	if !config.redirects {
+		client.Value.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+
+	return &nativeEngine{
+		config:   config,
+		client:   client,
+		onResult: onResult,
+	}
+}
+
+// request sends the request of the input, returning its result and whether it matched
+func (e *nativeEngine) request(ctx context.Context, input nativeInput) (Result, bool, error) {
+	parts := e.config.fill(input)
+	reqURL, method, body, cookie, headers := parts[0], parts[1], parts[2], parts[3], parts[4:]
+
+	req, err := e.client.NewRequest(method, reqURL)
+	if err != nil {
+		return Result{}, false, err
+	}
+	req = req.WithContext(ctx)
+
+	if body != "" {
+		req.Body = io.NopCloser(strings.NewReader(body))
+		req.ContentLength = int64(len(body))
+	}
+
+	if cookie != "" {
+		req.Header.Set("Cookie", cookie)
+	}
+
+	for _, header := range headers {
+		key, value, _ := strings.Cut(header, ":")
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+
+		if strings.EqualFold(key, "Host") {
+			req.Host = value
+			continue
+		}
+		req.Header.Set(key, value)
+	}
+
+	start := time.Now()
+	resp, _, err := e.client.Do(req)
+	if err != nil {
+		return Result{}, false, err
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Result{}, false, err
+	}
+	duration := time.Since(start)
+
+	var headerLines []string
+	for key, values := range resp.Header {
+		for _, value := range values {
+			headerLines = append(headerLines, fmt.Sprintf("%s: %s", key, value))
+		}
+	}
+
+	response := &nativeResponse{
+		status:  resp.StatusCode,
+		headers: strings.Join(headerLines, "\n"),
+		body:    string(content),
+		words:   len(strings.Split(string(content), " ")),
+		lines:   len(strings.Split(string(content), "\n")),
+	}
+
+	if !e.config.isMatch(response) {
+		return Result{}, false, nil
+	}
+
+	return Result{
+		Input:            input.values,
+		Status:           response.status,
+		Length:           len(content),
+		Words:            response.words,
+		Lines:            response.lines,
+		ContentType:      resp.Header.Get("Content-Type"),
+		RedirectLocation: resp.Header.Get("Location"),
+		Duration:         duration,
+		URL:              req.URL.String(),
+		Host:             req.URL.Host,
+	}, true, nil
+}
+
+// run sends the requests of all inputs until they are done or the context is canceled. The results are
+// sorted by position and the failed requests are reported as warnings.
+func (e *nativeEngine) run(ctx context.Context) (*Output, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if e.config.rate > 0 {
+		// Rates above a request per nanosecond are as fast as the ticker goes
+		ticker := time.NewTicker(max(time.Second/time.Duration(e.config.rate), time.Nanosecond))
+		defer ticker.Stop()
+		e.throttle = ticker.C
+	}
+
+	type job struct {
+		input    nativeInput
+		position int
+	}
+
+	var (
+		mutex       sync.Mutex
+		results     []Result
+		failed      int
+		lastErr     error
+		callbackErr error
+	)
+
+	jobs := make(chan job)
+	var wg sync.WaitGroup
+	for t := 0; t < max(e.config.threads, 1); t++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				result, matched, err := e.request(ctx, j.input)
+				if ctx.Err() != nil {
+					continue
+				}
+
+				mutex.Lock()
+				if err != nil {
+					failed++
+					lastErr = err
+				} else if matched {
+					result.Position = j.position
+					results = append(results, result)
+
+					if callbackErr == nil && e.onResult != nil {
+						callbackErr = e.onResult(result)
+						if callbackErr != nil {
+							cancel()
+						}
+					}
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	position := 0
+	e.config.generate(func(input nativeInput) bool {
+		position++
+
+		if e.throttle != nil {
+			select {
+			case <-e.throttle:
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		select {
+		case jobs <- job{input: input, position: position}:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	})
+	close(jobs)
+	wg.Wait()
+
+	if callbackErr != nil && callbackErr != errStopped {
+		return nil, callbackErr
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Position < results[j].Position
+	})
+
+	output := &Output{
+		CommandLine: "native " + strings.Join(e.config.args, " "),
+		Time:        time.Now().Format(time.RFC3339),
+		Results:     results,
+		Config: map[string]interface{}{
+			"url":     e.config.url,
+			"method":  e.config.method,
+			"mode":    e.config.mode,
+			"threads": e.config.threads,
+			"rate":    e.config.rate,
+			"timeout": e.config.timeout,
+		},
+	}
+
+	if failed != 0 {
+		output.Warnings = append(output.Warnings, fmt.Sprintf("%d requests failed, last error: %v", failed, lastErr))
+	}
+
+	if e.config.outputFile != "" {
+		content, err := json.Marshal(output)
+		if err != nil {
+			return nil, err
+		}
+
+		err = os.WriteFile(e.config.outputFile, content, 0644)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return output, nil
+}
+
+// errStopped is returned by the result callback when it stops the run
+var errStopped = errors.New("stopped by the result callback")
+
+// nativeResultCallback returns the function passing each result to the result callback if one is set.
+// It returns errStopped when the callback returns false.
+func (f *Fuzzer) nativeResultCallback() (func(Result) error, error) {
+	if f.onResult == nil {
+		return nil, nil
+	}
+
+	runner, err := interop.NewModuleFuncRunner(f.onResult, f.module.getCompiled, f.module.ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(result Result) error {
+		ret, err := f.runResultCallback(&runner, result)
+		if err != nil {
+			return err
+		}
+
+		if ret == tengo.FalseValue {
+			return errStopped
+		}
+		return nil
+	}, nil
+}
+
+// nativeArgs returns the ffuf arguments of the fuzzer, without looking up the ffuf binary
+func (f *Fuzzer) nativeArgs(fuzzer *ffuf.Fuzzer) ([]string, error) {
+	cmd, err := fuzzer.BinaryPath("ffuf").BuildCmd()
+	if err != nil {
+		return nil, err
+	}
+
+	return cmd.Args[1:], nil
+}
+
+// runNative runs the fuzzer with the native engine. When the run is interrupted by a signal, the results
+// found so far are returned along with exec.ErrSignaled.
+func (f *Fuzzer) runNative(ctx context.Context) (*Output, error) {
+	if f.checkpointFile != "" {
+		return nil, errors.New("resume is not supported by the native fuzzer")
+	}
+
+	args, err := f.nativeArgs(f.build(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	problems := ValidateArgs(args)
+	err = problemsError(problems)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := parseNativeConfig(args)
+	if err != nil {
+		return nil, err
+	}
+
+	onResult, err := f.nativeResultCallback()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	output, err := newNativeEngine(config, f.native, onResult).run(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, problem := range problems {
+		output.Warnings = append(output.Warnings, problem.String())
+	}
+
+	if ctx.Err() != nil && f.module.ctx.Err() == nil {
+		return output, modexec.ErrSignaled
+	}
+
+	return output, nil
+}
+
+// tengoNativeFuzzer creates a fuzzer sending its requests in process with the http client instead of
+// running ffuf. The default client is used when none is passed.
+// Represents 'ffuf.native_fuzzer(client HTTPClient?) Fuzzer'
+func (m *module) tengoNativeFuzzer(args interop.ArgMap) (tengo.Object, error) {
+	client := modhttp.NewHTTPClient(&http.Client{})
+	if obj, ok := args.GetObject("client"); ok {
+		client = obj.(*modhttp.HTTPClient)
+	}
+
+	fuzzer := makeFfufFuzzer(m, ffuf.NewFuzzer(m.ctx))
+	fuzzer.native = client
+	return fuzzer, nil
+}
@@ -0,0 +1,133 @@
+package ffuf
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/analog-substance/tengo/v2"
+	"github.com/analog-substance/tengomod/interop"
+	"github.com/analog-substance/tengomod/types"
+)
+
+// Result is a single result from ffuf's JSON output
+type Result struct {
+	Input            map[string]string `json:"input"`
+	Position         int               `json:"position"`
+	Status           int               `json:"status"`
+	Length           int               `json:"length"`
+	Words            int               `json:"words"`
+	Lines            int               `json:"lines"`
+	ContentType      string            `json:"content-type"`
+	RedirectLocation string            `json:"redirectlocation"`
+	Duration         time.Duration     `json:"duration"`
+	URL              string            `json:"url"`
+	Host             string            `json:"host"`
+}
+
+func (r Result) toTengo() tengo.Object {
+	return &tengo.ImmutableMap{
+		Value: map[string]tengo.Object{
+			"url":               interop.GoStrToTStr(r.URL),
+			"input":             interop.GoStrMapStrToTImmutMap(r.Input),
+			"position":          interop.GoIntToTInt(r.Position),
+			"status":            interop.GoIntToTInt(r.Status),
+			"length":            interop.GoIntToTInt(r.Length),
+			"words":             interop.GoIntToTInt(r.Words),
+			"lines":             interop.GoIntToTInt(r.Lines),
+			"content_type":      interop.GoStrToTStr(r.ContentType),
+			"redirect_location": interop.GoStrToTStr(r.RedirectLocation),
+			"duration":          interop.GoStrToTStr(r.Duration.String()),
+			"host":              interop.GoStrToTStr(r.Host),
+		},
+	}
+}
+
+// Output is the parsed JSON output of an ffuf run, along with the warnings ffuf printed
+type Output struct {
+	CommandLine string                 `json:"commandline"`
+	Time        string                 `json:"time"`
+	Results     []Result               `json:"results"`
+	Config      map[string]interface{} `json:"config"`
+	Warnings    []string               `json:"warnings"`
+}
+
+// ParseOutputFile parses ffuf's JSON output file. A missing file, which ffuf doesn't write when
+// there are no results and empty output is disabled, is parsed as an empty output.
+func ParseOutputFile(path string) (*Output, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Output{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	output := new(Output)
+	err = json.Unmarshal(content, output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ffuf output %s: %v", path, err)
+	}
+
+	return output, nil
+}
+
+// Results represents a tengo object wrapper for the output of an ffuf run
+type Results struct {
+	types.PropObject
+	Value *Output
+}
+
+// TypeName should return the name of the type.
+func (r *Results) TypeName() string {
+	return "ffuf-results"
+}
+
+// String should return a string representation of the type's value.
+func (r *Results) String() string {
+	return fmt.Sprintf("<ffuf-results>: %d results", len(r.Value.Results))
+}
+
+// IsFalsy should return true if the value of the type should be considered
+// as falsy.
+func (r *Results) IsFalsy() bool {
+	return r.Value == nil
+}
+
+// CanIterate should return whether the Object can be Iterated.
+func (r *Results) CanIterate() bool {
+	return false
+}
+
+func makeResults(output *Output) *Results {
+	results := &Results{
+		Value: output,
+	}
+
+	var values []tengo.Object
+	for _, result := range output.Results {
+		values = append(values, result.toTengo())
+	}
+
+	config, err := tengo.FromInterface(output.Config)
+	if err != nil || output.Config == nil {
+		config = &tengo.Map{Value: make(map[string]tengo.Object)}
+	}
+
+	results.PropObject = types.PropObject{
+		ObjectMap: make(map[string]tengo.Object),
+		Properties: map[string]types.Property{
+			"results":     types.StaticProperty(&tengo.ImmutableArray{Value: values}),
+			"config":      types.StaticProperty(config),
+			"warnings":    types.StaticProperty(interop.GoStrSliceToTArray(output.Warnings)),
+			"commandline": types.StaticProperty(interop.GoStrToTStr(output.CommandLine)),
+			"time":        types.StaticProperty(interop.GoStrToTStr(output.Time)),
+		},
+	}
+
+	return results
+}
@@ -0,0 +1,477 @@
+package ffuf_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/analog-substance/tengo/v2/require"
+	"github.com/analog-substance/tengomod/ffuf"
+	"github.com/analog-substance/tengomod/internal/test"
+)
+
+const ffufOutput = `{
+  "commandline": "ffuf -u http://example.com/FUZZ -w words.txt",
+  "time": "2024-01-01T00:00:00Z",
+  "results": [
+    {"input": {"FUZZ": "admin"}, "position": 1, "status": 301, "length": 162, "words": 5, "lines": 8, "content-type": "text/html", "redirectlocation": "http://example.com/admin/", "duration": 1500000, "url": "http://example.com/admin", "host": "example.com"},
+    {"input": {"FUZZ": "robots.txt"}, "position": 2, "status": 200, "length": 42, "words": 4, "lines": 3, "content-type": "text/plain", "redirectlocation": "", "duration": 2000000, "url": "http://example.com/robots.txt", "host": "example.com"}
+  ],
+  "config": {"url": "http://example.com/FUZZ", "threads": 40}
+}`
+
+// writeOutput writes the ffuf JSON output to a temp file
+func writeOutput(t *testing.T, output string) string {
+	path := filepath.Join(t.TempDir(), "output.json")
+	require.NoError(t, os.WriteFile(path, []byte(output), 0644))
+	return path
+}
+
+// writeWordlist writes a wordlist with a few words to a temp file
+func writeWordlist(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "words.txt")
+	require.NoError(t, os.WriteFile(path, []byte("admin\nrobots.txt\n"), 0644))
+	return path
+}
+
+// fakeFfuf puts an ffuf shell script in the PATH that writes the output to the -o file
+func fakeFfuf(t *testing.T, output string) {
+	fakeFfufScript(t, fmt.Sprintf(`echo '[WARN] Caught a warning' >&2
+cat %q > "$out"`, writeOutput(t, output)))
+}
+
+// fakeFfufScript puts an ffuf shell script with the body in the PATH. The body can use the -o file
+// as $out, the last -w wordlist as $wordlist, the -u URL as $url and the -rate as $rate.
+func fakeFfufScript(t *testing.T, body string) {
+	dir := t.TempDir()
+
+	script := fmt.Sprintf(`#!/bin/sh
+while [ $# -gt 0 ]; do
+	case "$1" in
+	-o) out="$2"; shift ;;
+	-w) wordlist="$2"; shift ;;
+	-u) url="$2"; shift ;;
+	-rate) rate="$2"; shift ;;
+	esac
+	shift
+done
+%s
+`, body)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ffuf"), []byte(script), 0755))
+
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestFfufRunResults(t *testing.T) {
+	fakeFfuf(t, ffufOutput)
+
+	wordlist := writeWordlist(t)
+	compiled := test.RunScript(t, fmt.Sprintf(`
+ffuf := import("ffuf")
+results := ffuf.fuzzer().target("http://example.com/FUZZ").wordlist(%q).run()
+first := results.results[0]
+summary := [
+	len(results.results), first.url, first.input.FUZZ, first.status, first.length, first.words, first.lines,
+	first.content_type, first.redirect_location, first.duration, results.results[1].status,
+	results.config.threads, results.warnings
+]
+`, wordlist))
+	require.Equal(t, test.Object(test.ARR{
+		2, "http://example.com/admin", "admin", 301, 162, 5, 8,
+		"text/html", "http://example.com/admin/", "1.5ms", 200,
+		40.0, test.ARR{"Caught a warning"},
+	}), compiled.Get("summary").Object())
+
+	outputFile := filepath.Join(t.TempDir(), "out.json")
+	compiled = test.RunScript(t, fmt.Sprintf(`
+ffuf := import("ffuf")
+results := ffuf.fuzzer().target("http://example.com/FUZZ").wordlist(%q).output_file(%q).add_json_warnings().run()
+count := len(results.results)
+`, wordlist, outputFile))
+	require.Equal(t, test.Object(2), compiled.Get("count").Object())
+
+	content, err := os.ReadFile(outputFile)
+	require.NoError(t, err)
+	require.True(t, strings.Contains(string(content), `"warnings": [`))
+}
+
+func TestFfufOnResult(t *testing.T) {
+	output := writeOutput(t, ffufOutput)
+	fakeFfufScript(t, fmt.Sprintf(`trap 'kill $! 2>/dev/null; cat %q > "$out"; exit 0' INT
+echo '{"input": {"FUZZ": "admin"}, "status": 301, "url": "http://example.com/admin"}'
+echo 'not a result'
+echo '{"input": {"FUZZ": "robots.txt"}, "status": 200, "url": "http://example.com/robots.txt"}'
+sleep 5 &
+wait
+echo '{"input": {"FUZZ": "never"}, "status": 200, "url": "http://example.com/never"}'`, output))
+
+	wordlist := writeWordlist(t)
+	compiled := test.RunScript(t, fmt.Sprintf(`
+ffuf := import("ffuf")
+urls := []
+results := ffuf.fuzzer().target("http://example.com/FUZZ").wordlist(%q).on_result(func(result) {
+	urls = append(urls, result.url)
+	if result.status == 200 {
+		return false
+	}
+}).run()
+count := len(results.results)
+`, wordlist))
+	require.Equal(t, test.Object(test.ARR{"http://example.com/admin", "http://example.com/robots.txt"}), compiled.Get("urls").Object())
+	require.Equal(t, test.Object(2), compiled.Get("count").Object())
+
+	fakeFfufScript(t, `echo '{"input": {"FUZZ": "admin"}, "status": 301, "url": "http://example.com/admin"}'`)
+	compiled = test.RunScript(t, fmt.Sprintf(`
+ffuf := import("ffuf")
+err := ffuf.fuzzer().target("http://example.com/FUZZ").wordlist(%q).on_result(func(result) {
+	return error("callback failed")
+}).run()
+`, wordlist))
+	require.True(t, strings.Contains(compiled.Get("err").String(), "callback failed"))
+}
+
+func TestFfufWordlist(t *testing.T) {
+	dir := t.TempDir()
+	fileA := filepath.Join(dir, "a.txt")
+	fileB := filepath.Join(dir, "b.txt")
+	require.NoError(t, os.WriteFile(fileA, []byte("admin\nlogin\n\n"), 0644))
+	require.NoError(t, os.WriteFile(fileB, []byte("login\nBackup\n"), 0644))
+
+	compiled := test.RunScript(t, fmt.Sprintf(`
+ffuf := import("ffuf")
+mutated := ffuf.wordlist_from(["admin", "Admin", " ", "login", "admin", "éclair"]).add_cases("upper", "title").add_extensions(".php").exclude("(?i)^login").words()
+merged := ffuf.wordlist_files(%q, %q).lower().filter("^(admin|backup)$")
+words := merged.words()
+count := merged.len
+`, fileA, fileB))
+	require.Equal(t, test.Object(test.ARR{
+		"admin", "Admin", "éclair", "ADMIN", "ÉCLAIR", "Éclair",
+		"admin.php", "Admin.php", "éclair.php", "ADMIN.php", "ÉCLAIR.php", "Éclair.php",
+	}), compiled.Get("mutated").Object())
+	require.Equal(t, test.Object(test.ARR{"admin", "backup"}), compiled.Get("words").Object())
+	require.Equal(t, test.Object(2), compiled.Get("count").Object())
+
+	captured := filepath.Join(dir, "captured.txt")
+	fakeFfufScript(t, fmt.Sprintf(`echo "$wordlist" > %q
+cat "${wordlist%%%%:*}" >> %q`, captured, captured))
+
+	compiled = test.RunScript(t, `
+ffuf := import("ffuf")
+wordlist := ffuf.wordlist_from(["admin", "backup"])
+fuzzer := ffuf.fuzzer().target("http://example.com/W1").wordlist(wordlist, "W1")
+fuzzer.run()
+fuzzer.clone().run()
+path := fuzzer.args()[1]
+`)
+	content, err := os.ReadFile(captured)
+	require.NoError(t, err)
+
+	lines := strings.Split(string(content), "\n")
+	require.True(t, strings.HasSuffix(lines[0], ":W1"))
+	require.Equal(t, []string{"admin", "backup", ""}, lines[1:])
+
+	_, err = os.Stat(strings.TrimSuffix(compiled.Get("path").String(), ":W1"))
+	require.True(t, os.IsNotExist(err))
+
+	test.RunScript(t, `
+ffuf := import("ffuf")
+ffuf.fuzzer().target("http://example.com/FUZZ").wordlist(ffuf.wordlist_from([])).run()
+`)
+	content, err = os.ReadFile(captured)
+	require.NoError(t, err)
+	require.Equal(t, 1, strings.Count(string(content), "\n"))
+
+	require.NoError(t, os.Remove(captured))
+	fakeFfufScript(t, fmt.Sprintf(`cat "${wordlist%%%%:*}" >> %q
+echo '{"input": {"W1": "admin"}, "status": 200, "url": "http://example.com/admin"}'`, captured))
+
+	test.RunScript(t, `
+ffuf := import("ffuf")
+wordlist := ffuf.wordlist_from(["admin"])
+fuzzer := ffuf.fuzzer().target("http://example.com/W1").wordlist(wordlist, "W1")
+nested := false
+fuzzer.on_result(func(result) {
+	if !nested {
+		nested = true
+		wordlist.add("backup")
+		fuzzer.clone().run()
+	}
+}).run()
+`)
+	content, err = os.ReadFile(captured)
+	require.NoError(t, err)
+	require.Equal(t, "admin\nadmin\nbackup\n", string(content))
+}
+
+func TestFfufCampaign(t *testing.T) {
+	dir := t.TempDir()
+	rates := filepath.Join(dir, "rates.txt")
+	fakeFfufScript(t, fmt.Sprintf(`echo "$rate" >> %q
+case "$url" in
+*fail*) echo 'not json' > "$out"; exit 1 ;;
+esac
+printf '{"results": [{"input": {"FUZZ": "admin"}, "status": 200, "url": "%%s"}]}' "${url%%%%FUZZ}admin" > "$out"`, rates))
+
+	outputDir := filepath.Join(dir, "output")
+	compiled := test.RunScript(t, fmt.Sprintf(`
+ffuf := import("ffuf")
+campaign := ffuf.campaign(ffuf.fuzzer().wordlist(%q), [
+	"http://a.example.com", "http://b.example.com/app/", "http://fail.example.com/FUZZ"
+], {concurrency: 2, global_rate: 100, output_dir: %q})
+urls := []
+for result in campaign.results {
+	urls = append(urls, result.url)
+}
+targets := []
+for target in campaign.targets {
+	targets = append(targets, [target.target, is_error(target.err)])
+}
+count := len(campaign.targets[1].results.results)
+`, writeWordlist(t), outputDir))
+	require.Equal(t, test.Object(test.ARR{
+		"http://a.example.com/admin", "http://b.example.com/app/admin",
+	}), compiled.Get("urls").Object())
+	require.Equal(t, test.Object(test.ARR{
+		test.ARR{"http://a.example.com", false},
+		test.ARR{"http://b.example.com/app/", false},
+		test.ARR{"http://fail.example.com/FUZZ", true},
+	}), compiled.Get("targets").Object())
+	require.Equal(t, test.Object(1), compiled.Get("count").Object())
+
+	content, err := os.ReadFile(rates)
+	require.NoError(t, err)
+	require.Equal(t, "50\n50\n50\n", string(content))
+
+	_, err = os.Stat(filepath.Join(outputDir, "0001-b.example.com.json"))
+	require.NoError(t, err)
+
+	require.NoError(t, os.Remove(rates))
+	fakeFfufScript(t, fmt.Sprintf(`echo "$rate" >> %q
+i=0
+while [ $i -lt 2000 ]; do i=$((i+1)); done
+printf '{"input": {"FUZZ": "admin"}, "status": 200, "url": "%%s"}\n' "${url%%%%FUZZ}admin"
+printf '{"results": [{"input": {"FUZZ": "admin"}, "status": 200, "url": "%%s"}]}' "${url%%%%FUZZ}admin" > "$out"`, rates))
+
+	compiled = test.RunScript(t, fmt.Sprintf(`
+ffuf := import("ffuf")
+count := 0
+template := ffuf.fuzzer().target("http://template.example.com").auto_append_keyword().wordlist(%q).on_result(func(result) {
+	count += 1
+})
+campaign := ffuf.campaign(template, [
+	"http://a.example.com/FUZZ", "http://b.example.com", "http://c.example.com/FUZZ"
+], {concurrency: 4, global_rate: 2})
+urls := []
+for result in campaign.results {
+	urls = append(urls, result.url)
+}
+output_files := []
+for target in campaign.targets {
+	output_files = append(output_files, target.output_file)
+}
+`, writeWordlist(t)))
+	require.Equal(t, test.Object(test.ARR{
+		"http://a.example.com/admin", "http://b.example.com/admin", "http://c.example.com/admin",
+	}), compiled.Get("urls").Object())
+	require.Equal(t, test.Object(3), compiled.Get("count").Object())
+	require.Equal(t, test.Object(test.ARR{"", "", ""}), compiled.Get("output_files").Object())
+
+	content, err = os.ReadFile(rates)
+	require.NoError(t, err)
+	require.Equal(t, "1\n1\n1\n", string(content))
+}
+
+func TestFfufResume(t *testing.T) {
+	dir := t.TempDir()
+
+	var words []string
+	for i := 0; i < 100; i++ {
+		words = append(words, fmt.Sprintf("w%d", i))
+	}
+	wordlist := filepath.Join(dir, "words.txt")
+	require.NoError(t, os.WriteFile(wordlist, []byte(strings.Join(words, "\n")), 0644))
+
+	runs := filepath.Join(dir, "runs.txt")
+	fakeFfufScript(t, fmt.Sprintf(`head -n 1 "${wordlist%%%%:*}" >> %q
+if [ "$(wc -l < %q)" -eq 1 ]; then
+	printf ':: Progress: [30/100] ::\r:: Progress: [60/100] ::' >&2
+	echo '{"results": [{"input": {"FUZZ": "w4"}, "position": 5, "status": 200}, {"input": {"FUZZ": "w54"}, "position": 55, "status": 200}]}' > "$out"
+	kill -TERM $$
+fi
+printf ':: Progress: [50/50] ::' >&2
+echo '{"results": [{"input": {"FUZZ": "w50"}, "position": 1, "status": 200}]}' > "$out"`, runs, runs))
+
+	checkpoint := filepath.Join(dir, "checkpoint.json")
+	compiled := test.RunScript(t, fmt.Sprintf(`
+ffuf := import("ffuf")
+exec := import("exec")
+fuzzer := ffuf.fuzzer().target("http://example.com/FUZZ").wordlist(%q, "FUZZ").threads(10).resume(%q)
+interrupted := string(fuzzer.run()) == string(exec.err_signaled)
+positions := []
+for result in fuzzer.clone().run().results {
+	positions = append(positions, result.position)
+}
+count := len(fuzzer.run().results)
+`, wordlist, checkpoint))
+	require.Equal(t, test.Object(true), compiled.Get("interrupted").Object())
+	require.Equal(t, test.Object(test.ARR{5, 51}), compiled.Get("positions").Object())
+	require.Equal(t, test.Object(2), compiled.Get("count").Object())
+
+	content, err := os.ReadFile(runs)
+	require.NoError(t, err)
+	require.Equal(t, "w0\nw50\n", string(content))
+
+	_, err = os.Stat(checkpoint)
+	require.NoError(t, err)
+
+	compiled = test.RunScript(t, fmt.Sprintf(`
+ffuf := import("ffuf")
+fuzzer := ffuf.fuzzer().target("http://example.com/FUZZ").wordlist(%q, "FUZZ").resume(%q)
+with_on_result := fuzzer.clone().on_result(func(result) {}).run()
+with_silent := fuzzer.clone().silent().run()
+with_calibration := fuzzer.clone().auto_calibrate().run()
+`, wordlist, checkpoint))
+	require.True(t, strings.Contains(compiled.Get("with_on_result").String(), "resume is not supported with on_result"))
+	require.True(t, strings.Contains(compiled.Get("with_silent").String(), "resume is not supported with on_result"))
+	require.True(t, strings.Contains(compiled.Get("with_calibration").String(), "resume is not supported with auto-calibration"))
+
+	content, err = os.ReadFile(runs)
+	require.NoError(t, err)
+	require.Equal(t, "w0\nw50\n", string(content))
+}
+
+func TestFfufValidate(t *testing.T) {
+	fakeFfuf(t, ffufOutput)
+	wordlist := writeWordlist(t)
+	missing := filepath.Join(t.TempDir(), "missing.txt")
+	colon := filepath.Join(t.TempDir(), "a:b.txt")
+	require.NoError(t, os.WriteFile(colon, []byte("admin\n"), 0644))
+
+	compiled := test.RunScript(t, fmt.Sprintf(`
+ffuf := import("ffuf")
+fuzzer := ffuf.fuzzer().target("http://example.com/FUZZ").wordlist(%q).wordlist(%q, "W2").match_codes("200", "301").filter_codes("301").match_operator("and")
+problems := []
+for problem in fuzzer.validate() {
+	problems = append(problems, [problem.severity, problem.option, problem.message])
+}
+err := fuzzer.run()
+valid := len(ffuf.fuzzer().target("http://example.com/FUZZ").wordlist(%q).validate())
+colon_valid := len(ffuf.fuzzer().target("http://example.com/FUZZ").wordlist(%q).validate())
+`, wordlist, missing, wordlist, colon))
+	require.Equal(t, test.Object(test.ARR{
+		test.ARR{"error", "-w", fmt.Sprintf("wordlist %s doesn't exist", missing)},
+		test.ARR{"error", "-w", "keyword W2 isn't used in the URL, headers or body"},
+		test.ARR{"warning", "-mmode", "operator has no effect with less than two options"},
+		test.ARR{"warning", "-fc", "301 is both matched by -mc and filtered"},
+	}), compiled.Get("problems").Object())
+	require.True(t, strings.Contains(compiled.Get("err").String(), "invalid fuzzer configuration: -w: wordlist"))
+	require.Equal(t, test.Object(0), compiled.Get("valid").Object())
+	require.Equal(t, test.Object(0), compiled.Get("colon_valid").Object())
+
+	compiled = test.RunScript(t, fmt.Sprintf(`
+ffuf := import("ffuf")
+prefixed := []
+for problem in ffuf.fuzzer().target("http://example.com/W10").wordlist(%q, "W1").wordlist(%q, "W10").validate() {
+	prefixed = append(prefixed, problem.message)
+}
+commanded := len(ffuf.fuzzer().target("http://example.com/NUM").input_command("seq 1 3:NUM").validate())
+`, wordlist, wordlist))
+	require.Equal(t, test.Object(test.ARR{"keyword W1 isn't used in the URL, headers or body"}), compiled.Get("prefixed").Object())
+	require.Equal(t, test.Object(0), compiled.Get("commanded").Object())
+
+	compiled = test.RunScript(t, `
+ffuf := import("ffuf")
+fuzzer := ffuf.fuzzer().target("http://a.example.com/FUZZ").wordlist("words.txt")
+retargeted := fuzzer.clone().target("http://b.example.com/FUZZ").args()
+appended := fuzzer.clone().target("http://c.example.com").auto_append_keyword().args()
+`)
+	require.Equal(t, test.Object(test.ARR{"-w", "words.txt", "-u", "http://b.example.com/FUZZ"}), compiled.Get("retargeted").Object())
+	require.Equal(t, test.Object(test.ARR{"-w", "words.txt"}), compiled.Get("appended").Object())
+}
+
+func TestFfufNative(t *testing.T) {
+	var flaky atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/flaky":
+			if flaky.Add(1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		case "/admin":
+			http.Redirect(w, r, "/admin/", http.StatusMovedPermanently)
+		case "/robots.txt":
+			fmt.Fprint(w, "User-agent: *\nDisallow: /admin")
+		case "/api/v1/users", "/api/v2/users":
+			fmt.Fprintf(w, "%s users", r.UserAgent())
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	wordlist := writeWordlist(t)
+	outputFile := filepath.Join(t.TempDir(), "output.json")
+
+	compiled := test.RunScript(t, fmt.Sprintf(`
+ffuf := import("ffuf")
+http := import("http")
+results := ffuf.native_fuzzer().target(%q).wordlist(%q).output_file(%q).output_format("json").run()
+found := []
+for result in results.results {
+	found = append(found, [result.input.FUZZ, result.status, result.redirect_location, result.lines])
+}
+
+client := http.new_client().user_agent("tester")
+versions := ffuf.wordlist_from(["v1", "v2", "v3"])
+resources := ffuf.wordlist_from(["users", "groups"])
+fuzzer := ffuf.native_fuzzer(client).target(%q).wordlist(versions, "VER").wordlist(resources, "RES").threads(2)
+bombed := []
+for result in fuzzer.run().results {
+	bombed = append(bombed, [result.position, result.url, result.words])
+}
+filtered := len(fuzzer.clone().filter_regex("tester").run().results)
+forked := len(fuzzer.clone().wordlist_mode("pitchfork").match_codes("all").run().results)
+
+seen := 0
+fuzzer.on_result(func(result) {
+	seen++
+	return false
+}).run()
+
+sniped := []
+for result in ffuf.native_fuzzer().target(%q).wordlist(ffuf.wordlist_from(["v2"])).wordlist_mode("sniper").run().results {
+	sniped = append(sniped, result.url)
+}
+
+unsupported := ffuf.native_fuzzer().target(%q).wordlist(%q).auto_calibrate().run()
+
+retrying := http.new_client().retry({max: 1, backoff: "1ms"})
+retried := []
+for result in ffuf.native_fuzzer(retrying).target(%q).wordlist(ffuf.wordlist_from(["flaky"])).request_rate(2000000000).run().results {
+	retried = append(retried, result.status)
+}
+`, server.URL+"/FUZZ", wordlist, outputFile, server.URL+"/api/VER/RES", server.URL+"/api/§v1§/§users§", server.URL+"/FUZZ", wordlist, server.URL+"/FUZZ"))
+	require.Equal(t, test.Object(test.ARR{
+		test.ARR{"admin", 301, "/admin/", 3},
+		test.ARR{"robots.txt", 200, "", 2},
+	}), compiled.Get("found").Object())
+	require.Equal(t, test.Object(test.ARR{
+		test.ARR{1, server.URL + "/api/v1/users", 2},
+		test.ARR{3, server.URL + "/api/v2/users", 2},
+	}), compiled.Get("bombed").Object())
+	require.Equal(t, test.Object(0), compiled.Get("filtered").Object())
+	require.Equal(t, test.Object(2), compiled.Get("forked").Object())
+	require.Equal(t, test.Object(1), compiled.Get("seen").Object())
+	require.Equal(t, test.Object(test.ARR{server.URL + "/api/v2/users"}), compiled.Get("sniped").Object())
+	require.True(t, strings.Contains(compiled.Get("unsupported").String(), "options not supported by the native fuzzer: -ac"))
+	require.Equal(t, test.Object(test.ARR{200}), compiled.Get("retried").Object())
+
+	output, err := ffuf.ParseOutputFile(outputFile)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(output.Results))
+}
@@ -0,0 +1,339 @@
+package ffuf
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	ffuf "github.com/analog-substance/ffufwrap"
+	"github.com/analog-substance/tengo/v2"
+	"github.com/analog-substance/tengomod/interop"
+)
+
+const (
+	SeverityError   string = "error"
+	SeverityWarning string = "warning"
+
+	defaultKeyword string = "FUZZ"
+)
+
+// boolFlags are the ffuf flags that don't take a value
+var boolFlags []string = []string{
+	"-D", "-V", "-ac", "-ach", "-c", "-http2", "-ic", "-ignore-body", "-json", "-noninteractive", "-or", "-r",
+	"-recursion", "-s", "-sa", "-se", "-sf", "-silent", "-v",
+}
+
+var (
+	matchers []string = []string{"-mc", "-ml", "-mr", "-ms", "-mt", "-mw"}
+	filters  []string = []string{"-fc", "-fl", "-fr", "-fs", "-ft", "-fw"}
+
+	// matcherFilters are the matchers and the filters of the same response property
+	matcherFilters [][2]string = [][2]string{
+		{"-mc", "-fc"},
+		{"-ms", "-fs"},
+		{"-mw", "-fw"},
+		{"-ml", "-fl"},
+	}
+)
+
+// Problem is a problem with the configuration of a fuzzer
+type Problem struct {
+	Severity string
+	Option   string
+	Message  string
+}
+
+func (p Problem) toTengo() tengo.Object {
+	return &tengo.ImmutableMap{
+		Value: map[string]tengo.Object{
+			"severity": interop.GoStrToTStr(p.Severity),
+			"option":   interop.GoStrToTStr(p.Option),
+			"message":  interop.GoStrToTStr(p.Message),
+		},
+	}
+}
+
+// String returns the problem as it is shown in errors and warnings
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s", p.Option, p.Message)
+}
+
+// parseFlags returns the values of each flag in the ffuf arguments. Flags without a value have an
+// empty value.
+func parseFlags(args []string) map[string][]string {
+	flags := make(map[string][]string)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+
+		if name, value, ok := strings.Cut(arg, "="); ok {
+			flags[name] = append(flags[name], value)
+			continue
+		}
+
+		if slices.Contains(boolFlags, arg) || i+1 == len(args) {
+			flags[arg] = append(flags[arg], "")
+			continue
+		}
+
+		flags[arg] = append(flags[arg], args[i+1])
+		i++
+	}
+
+	return flags
+}
+
+// lastFlag returns the last value of the flag, which is the one used by ffuf
+func lastFlag(flags map[string][]string, name string) (string, bool) {
+	values := flags[name]
+	if len(values) == 0 {
+		return "", false
+	}
+	return values[len(values)-1], true
+}
+
+// usedKeywords returns which keywords appear in the text. The longest keywords are matched first and
+// removed from the text, so W1 isn't found within W10.
+func usedKeywords(text string, keywords []string) map[string]bool {
+	sorted := append([]string{}, keywords...)
+	slices.SortFunc(sorted, func(a, b string) int {
+		return len(b) - len(a)
+	})
+
+	used := make(map[string]bool)
+	for _, keyword := range sorted {
+		if strings.Contains(text, keyword) {
+			used[keyword] = true
+			text = strings.ReplaceAll(text, keyword, "")
+		}
+	}
+
+	return used
+}
+
+// ValidateArgs checks the ffuf arguments for problems, like keywords not used in the request,
+// missing wordlists and conflicting options
+func ValidateArgs(args []string) []Problem {
+	var problems []Problem
+	add := func(severity string, option string, format string, a ...interface{}) {
+		problems = append(problems, Problem{
+			Severity: severity,
+			Option:   option,
+			Message:  fmt.Sprintf(format, a...),
+		})
+	}
+
+	flags := parseFlags(args)
+
+	// The parts of the request the keywords can be used in
+	var request []string
+	for _, name := range []string{"-u", "-H", "-d", "-X", "-b"} {
+		request = append(request, flags[name]...)
+	}
+
+	if requestFile, ok := lastFlag(flags, "-request"); ok {
+		content, err := os.ReadFile(requestFile)
+		if err != nil {
+			add(SeverityError, "-request", "raw request file %s can't be read: %v", requestFile, err)
+		}
+		request = append(request, string(content))
+	} else if _, ok := lastFlag(flags, "-u"); !ok {
+		add(SeverityError, "-u", "no target URL is set")
+	}
+
+	var keywords []string
+	for _, wordlist := range flags["-w"] {
+		path, keyword := splitWordlistArg(wordlist)
+		keyword = strings.TrimPrefix(keyword, ":")
+		if keyword == "" {
+			keyword = defaultKeyword
+		}
+
+		if _, err := os.Stat(path); err != nil {
+			add(SeverityError, "-w", "wordlist %s doesn't exist", path)
+		}
+
+		if slices.Contains(keywords, keyword) {
+			add(SeverityError, "-w", "keyword %s is used by more than one wordlist", keyword)
+		}
+		keywords = append(keywords, keyword)
+	}
+
+	for _, command := range flags["-input-cmd"] {
+		_, keyword := splitWordlistArg(command)
+		keyword = strings.TrimPrefix(keyword, ":")
+		if keyword == "" {
+			keyword = defaultKeyword
+		}
+		keywords = append(keywords, keyword)
+	}
+
+	if _, ok := lastFlag(flags, "-input-num"); ok && len(flags["-input-cmd"]) == 0 {
+		add(SeverityWarning, "-input-num", "input count has no effect without an input command")
+	}
+
+	if len(keywords) == 0 {
+		add(SeverityError, "-w", "no wordlist or input command is set")
+	}
+
+	mode, ok := lastFlag(flags, "-mode")
+
+	// The sniper mode replaces the marked positions instead of the keywords
+	requestText := strings.Join(request, "\n")
+	if mode == string(ffuf.ModeSniper) {
+		if !strings.Contains(requestText, sniperMarker) {
+			add(SeverityError, "-mode", "no position is marked with %s in the URL, headers or body", sniperMarker)
+		}
+	} else {
+		used := usedKeywords(requestText, keywords)
+		for _, keyword := range keywords {
+			if !used[keyword] {
+				add(SeverityError, "-w", "keyword %s isn't used in the URL, headers or body", keyword)
+			}
+		}
+	}
+
+	if ok && !slices.Contains([]string{string(ffuf.ModeClusterBomb), string(ffuf.ModePitchFork), string(ffuf.ModeSniper)}, mode) {
+		add(SeverityError, "-mode", "unknown wordlist mode %s", mode)
+	}
+
+	if mode == string(ffuf.ModeSniper) && len(flags["-w"]) != 1 {
+		add(SeverityError, "-mode", "sniper mode requires exactly one wordlist")
+	}
+
+	if _, ok := lastFlag(flags, "-recursion"); ok {
+		url, _ := lastFlag(flags, "-u")
+		if !strings.HasSuffix(url, defaultKeyword) {
+			add(SeverityError, "-recursion", "the URL must end with the %s keyword when using recursion", defaultKeyword)
+		}
+	}
+
+	operators := []struct {
+		op      string
+		options []string
+	}{
+		{"-mmode", matchers},
+		{"-fmode", filters},
+	}
+	for _, operator := range operators {
+		op := operator.op
+		value, ok := lastFlag(flags, op)
+		if !ok {
+			continue
+		}
+
+		if value != string(ffuf.OrOperator) && value != string(ffuf.AndOperator) {
+			add(SeverityError, op, "unknown operator %s", value)
+		}
+
+		count := 0
+		for _, option := range operator.options {
+			if _, ok := flags[option]; ok {
+				count++
+			}
+		}
+
+		if count < 2 {
+			add(SeverityWarning, op, "operator has no effect with less than two options")
+		}
+	}
+
+	for _, pair := range matcherFilters {
+		matched, _ := lastFlag(flags, pair[0])
+		filtered, _ := lastFlag(flags, pair[1])
+		for _, value := range strings.Split(matched, ",") {
+			if value != "" && value != "all" && slices.Contains(strings.Split(filtered, ","), value) {
+				add(SeverityWarning, pair[1], "%s is both matched by %s and filtered", value, pair[0])
+			}
+		}
+	}
+
+	_, silent := flags["-s"]
+	_, silentLong := flags["-silent"]
+	if _, verbose := flags["-v"]; verbose && (silent || silentLong) {
+		add(SeverityWarning, "-v", "verbose output has no effect in silent mode")
+	}
+
+	if _, ok := lastFlag(flags, "-d"); ok {
+		if method, _ := lastFlag(flags, "-X"); strings.EqualFold(method, "GET") {
+			add(SeverityWarning, "-d", "a request body is set but the method is GET")
+		}
+	}
+
+	if _, ok := lastFlag(flags, "-of"); ok {
+		if _, ok := lastFlag(flags, "-o"); !ok {
+			add(SeverityWarning, "-of", "output format has no effect without an output file")
+		}
+	}
+
+	return problems
+}
+
+// problemsError returns an error with the problems that are errors, or nil if there are none
+func problemsError(problems []Problem) error {
+	var messages []string
+	for _, problem := range problems {
+		if problem.Severity == SeverityError {
+			messages = append(messages, problem.String())
+		}
+	}
+
+	if len(messages) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("invalid fuzzer configuration: %s", strings.Join(messages, "; "))
+}
+
+// Validate checks the fuzzer's configuration for problems. The ffuf binary not being found is a problem.
+func (f *Fuzzer) Validate() ([]Problem, error) {
+	releaseWordlists, err := f.acquireWordlists()
+	if err != nil {
+		return nil, err
+	}
+	defer releaseWordlists()
+
+	var problems []Problem
+
+	if f.native != nil {
+		args, err := f.nativeArgs(f.build(f.module.ctx))
+		if err != nil {
+			return nil, err
+		}
+		return ValidateArgs(args), nil
+	}
+
+	fuzzer := f.build(f.module.ctx)
+	args := fuzzer.Args()
+	cmd, err := fuzzer.BuildCmd()
+	if err != nil {
+		problems = append(problems, Problem{
+			Severity: SeverityError,
+			Option:   "binary_path",
+			Message:  err.Error(),
+		})
+	} else {
+		args = cmd.Args[1:]
+	}
+
+	return append(problems, ValidateArgs(args)...), nil
+}
+
+// validate checks the fuzzer's configuration for problems
+// Represents 'fuzzer.validate() []{severity: string, option: string, message: string}|error'
+func (f *Fuzzer) validate(args ...tengo.Object) (tengo.Object, error) {
+	problems, err := f.Validate()
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+
+	var values []tengo.Object
+	for _, problem := range problems {
+		values = append(values, problem.toTengo())
+	}
+
+	return &tengo.ImmutableArray{Value: values}, nil
+}
@@ -0,0 +1,88 @@
+package ffuf
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/analog-substance/tengo/v2"
+	"github.com/analog-substance/tengomod/interop"
+)
+
+// stopWaitDelay is how long ffuf has to write its output after being interrupted before it is killed
+const stopWaitDelay time.Duration = 10 * time.Second
+
+// watchResults passes each result printed by ffuf's -json output to the result callback if one is set.
+// When the callback returns false or an error, stop is called and ffuf is interrupted, letting it write
+// the results found so far. The returned function waits for the remaining output to be processed and
+// returns the first error from the callback.
+func (f *Fuzzer) watchResults(cmd *exec.Cmd, stop func()) (func() error, error) {
+	if f.onResult == nil {
+		return func() error {
+			return nil
+		}, nil
+	}
+
+	runner, err := interop.NewModuleFuncRunner(f.onResult, f.module.getCompiled, f.module.ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(os.Interrupt)
+	}
+	cmd.WaitDelay = stopWaitDelay
+
+	// The JSON lines replace ffuf's normal output, so they aren't passed through to stdout
+	pr, pw := io.Pipe()
+	cmd.Stdout = pw
+
+	done := make(chan error, 1)
+	go func() {
+		var callbackErr error
+		stopped := false
+
+		scanner := bufio.NewScanner(pr)
+		scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+		for scanner.Scan() {
+			if stopped {
+				continue
+			}
+
+			var result Result
+			if json.Unmarshal(scanner.Bytes(), &result) != nil {
+				continue
+			}
+
+			var ret tengo.Object
+			ret, callbackErr = f.runResultCallback(&runner, result)
+			if callbackErr != nil || ret == tengo.FalseValue {
+				stopped = true
+				stop()
+			}
+		}
+
+		// Make sure ffuf never blocks writing to stdout
+		io.Copy(io.Discard, pr)
+		done <- callbackErr
+	}()
+
+	return func() error {
+		pw.Close()
+		return <-done
+	}, nil
+}
+
+// runResultCallback passes the result to the result callback, taking turns with the other fuzzers of
+// the campaign running the fuzzer
+func (f *Fuzzer) runResultCallback(runner *interop.CompiledFuncRunner, result Result) (tengo.Object, error) {
+	if f.callbackMutex != nil {
+		f.callbackMutex.Lock()
+		defer f.callbackMutex.Unlock()
+	}
+
+	return runner.Run(result.toTengo())
+}
@@ -0,0 +1,455 @@
+package ffuf
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/analog-substance/tengo/v2"
+	"github.com/analog-substance/tengomod/interop"
+	"github.com/analog-substance/tengomod/types"
+)
+
+// Wordlist is a deduplicated list of words used by fuzzers. The file passed to ffuf is rewritten
+// before each run using the wordlist and removed once no runs are using it.
+type Wordlist struct {
+	types.PropObject
+
+	mutex sync.Mutex
+	words []string
+	seen  map[string]bool
+	path  string
+	users int
+}
+
+// TypeName should return the name of the type.
+func (w *Wordlist) TypeName() string {
+	return "ffuf-wordlist"
+}
+
+// String should return a string representation of the type's value.
+func (w *Wordlist) String() string {
+	return fmt.Sprintf("<ffuf-wordlist>: %d words", w.Len())
+}
+
+// IsFalsy should return true if the value of the type should be considered
+// as falsy.
+func (w *Wordlist) IsFalsy() bool {
+	return w.Len() == 0
+}
+
+// CanIterate should return whether the Object can be Iterated.
+func (w *Wordlist) CanIterate() bool {
+	return false
+}
+
+// Len returns the number of words in the wordlist
+func (w *Wordlist) Len() int {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return len(w.words)
+}
+
+// Words returns a copy of the words in the wordlist
+func (w *Wordlist) Words() []string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return append([]string{}, w.words...)
+}
+
+// Add adds the words that aren't already in the wordlist. Surrounding whitespace is trimmed
+// and empty words are skipped.
+func (w *Wordlist) Add(words ...string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.add(words...)
+}
+
+func (w *Wordlist) add(words ...string) {
+	for _, word := range words {
+		word = strings.TrimSpace(word)
+		if word == "" || w.seen[word] {
+			continue
+		}
+
+		w.seen[word] = true
+		w.words = append(w.words, word)
+	}
+}
+
+// AddFiles adds the words from each line of the files
+func (w *Wordlist) AddFiles(paths ...string) error {
+	for _, path := range paths {
+		words, err := readLines(path)
+		if err != nil {
+			return err
+		}
+
+		w.Add(words...)
+	}
+
+	return nil
+}
+
+// Map replaces the words with the result of fn, removing any duplicates it creates
+func (w *Wordlist) Map(fn func(string) string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	words := w.words
+	w.words = nil
+	w.seen = make(map[string]bool)
+
+	for _, word := range words {
+		w.add(fn(word))
+	}
+}
+
+// Mutate adds the results of each mutation of each word
+func (w *Wordlist) Mutate(mutations ...func(string) string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	for _, word := range append([]string{}, w.words...) {
+		for _, mutation := range mutations {
+			w.add(mutation(word))
+		}
+	}
+}
+
+// Filter keeps the words for which keep returns true
+func (w *Wordlist) Filter(keep func(string) bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	var words []string
+	for _, word := range w.words {
+		if keep(word) {
+			words = append(words, word)
+		} else {
+			delete(w.seen, word)
+		}
+	}
+
+	w.words = words
+}
+
+// WriteFile writes the words to the file, one per line
+func (w *Wordlist) WriteFile(path string) error {
+	w.mutex.Lock()
+	content := w.content()
+	w.mutex.Unlock()
+
+	return os.WriteFile(path, []byte(content), 0644)
+}
+
+// content returns the words one per line, or nothing when there are no words
+func (w *Wordlist) content() string {
+	if len(w.words) == 0 {
+		return ""
+	}
+
+	return strings.Join(w.words, "\n") + "\n"
+}
+
+// acquire writes the current words to the wordlist's file. The file is replaced rather than
+// truncated, so runs already reading it keep the words they started with.
+func (w *Wordlist) acquire() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	err := w.replaceFile(w.content())
+	if err != nil {
+		return err
+	}
+
+	w.users++
+	return nil
+}
+
+// release removes the wordlist's file once no runs are using it
+func (w *Wordlist) release() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.users--
+	if w.users == 0 {
+		os.Remove(w.path)
+	}
+}
+
+// replaceFile atomically replaces the wordlist's file with one containing the content
+func (w *Wordlist) replaceFile(content string) error {
+	file, err := os.CreateTemp(filepath.Dir(w.path), "ffuf-wordlist-*.txt")
+	if err != nil {
+		return err
+	}
+
+	_, err = file.WriteString(content)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(file.Name(), w.path)
+	}
+
+	if err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+
+	return nil
+}
+
+func readLines(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	return lines, scanner.Err()
+}
+
+var caseMutations map[string]func(string) string = map[string]func(string) string{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"title": func(s string) string {
+		if s == "" {
+			return s
+		}
+		r, size := utf8.DecodeRuneInString(s)
+		return string(unicode.ToUpper(r)) + strings.ToLower(s[size:])
+	},
+}
+
+// tengoAdd adds the words to the wordlist
+// Represents 'wordlist.add(words ...string) Wordlist'
+func (w *Wordlist) tengoAdd(args interop.ArgMap) (tengo.Object, error) {
+	words, _ := args.GetStringSlice("words")
+
+	w.Add(words...)
+	return w, nil
+}
+
+// tengoAddFiles adds the words from each line of the files
+// Represents 'wordlist.add_files(paths ...string) Wordlist|error'
+func (w *Wordlist) tengoAddFiles(args interop.ArgMap) (tengo.Object, error) {
+	paths, _ := args.GetStringSlice("paths")
+
+	err := w.AddFiles(paths...)
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+
+	return w, nil
+}
+
+// caseFunc creates the function converting each word to the case
+// Represents 'wordlist.lower() Wordlist' and 'wordlist.upper() Wordlist'
+func (w *Wordlist) caseFunc(c string) tengo.CallableFunc {
+	return func(args ...tengo.Object) (tengo.Object, error) {
+		w.Map(caseMutations[c])
+		return w, nil
+	}
+}
+
+// addCases adds a variant of each word in each case, which can be lower, upper or title
+// Represents 'wordlist.add_cases(cases ...string) Wordlist|error'
+func (w *Wordlist) addCases(args interop.ArgMap) (tengo.Object, error) {
+	cases, _ := args.GetStringSlice("cases")
+
+	var mutations []func(string) string
+	for _, c := range cases {
+		mutation, ok := caseMutations[c]
+		if !ok {
+			return interop.GoErrToTErr(fmt.Errorf("unknown case: %s", c)), nil
+		}
+		mutations = append(mutations, mutation)
+	}
+
+	w.Mutate(mutations...)
+	return w, nil
+}
+
+// addExtensions adds a variant of each word with each extension appended as is
+// Represents 'wordlist.add_extensions(exts ...string) Wordlist'
+func (w *Wordlist) addExtensions(args interop.ArgMap) (tengo.Object, error) {
+	exts, _ := args.GetStringSlice("exts")
+
+	var mutations []func(string) string
+	for _, ext := range exts {
+		mutations = append(mutations, func(s string) string {
+			return s + ext
+		})
+	}
+
+	w.Mutate(mutations...)
+	return w, nil
+}
+
+// filterFunc creates the function keeping the words that match the regex, or that don't match
+// it when exclude is true
+// Represents 'wordlist.filter(regex string) Wordlist' and 'wordlist.exclude(regex string) Wordlist'
+func (w *Wordlist) filterFunc(exclude bool) func(interop.ArgMap) (tengo.Object, error) {
+	return func(args interop.ArgMap) (tengo.Object, error) {
+		re, _ := args.GetRegex("regex")
+
+		w.Filter(func(s string) bool {
+			return re.MatchString(s) != exclude
+		})
+		return w, nil
+	}
+}
+
+// write writes the words to the file
+// Represents 'wordlist.write(path string) error'
+func (w *Wordlist) write(args interop.ArgMap) (tengo.Object, error) {
+	path, _ := args.GetString("path")
+
+	err := w.WriteFile(path)
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+
+	return nil, nil
+}
+
+// NewWordlist creates a wordlist with the words. A unique path is picked for its temporary file,
+// which only exists while runs are using the wordlist.
+func NewWordlist(words ...string) (*Wordlist, error) {
+	file, err := os.CreateTemp("", "ffuf-wordlist-*.txt")
+	if err != nil {
+		return nil, err
+	}
+	file.Close()
+	os.Remove(file.Name())
+
+	wordlist := &Wordlist{
+		seen: make(map[string]bool),
+		path: file.Name(),
+	}
+	wordlist.Add(words...)
+
+	return wordlist, nil
+}
+
+func makeWordlist(wordlist *Wordlist) *Wordlist {
+	objectMap := map[string]tengo.Object{
+		"add": &interop.AdvFunction{
+			Name:  "add",
+			Args:  []interop.AdvArg{interop.StrSliceArg("words", true)},
+			Value: wordlist.tengoAdd,
+		},
+		"add_files": &interop.AdvFunction{
+			Name:    "add_files",
+			NumArgs: interop.MinArgs(1),
+			Args:    []interop.AdvArg{interop.StrSliceArg("paths", true)},
+			Value:   wordlist.tengoAddFiles,
+		},
+		"lower": &tengo.UserFunction{
+			Name:  "lower",
+			Value: wordlist.caseFunc("lower"),
+		},
+		"upper": &tengo.UserFunction{
+			Name:  "upper",
+			Value: wordlist.caseFunc("upper"),
+		},
+		"add_cases": &interop.AdvFunction{
+			Name:    "add_cases",
+			NumArgs: interop.MinArgs(1),
+			Args:    []interop.AdvArg{interop.StrSliceArg("cases", true)},
+			Value:   wordlist.addCases,
+		},
+		"add_extensions": &interop.AdvFunction{
+			Name:    "add_extensions",
+			NumArgs: interop.MinArgs(1),
+			Args:    []interop.AdvArg{interop.StrSliceArg("exts", true)},
+			Value:   wordlist.addExtensions,
+		},
+		"filter": &interop.AdvFunction{
+			Name:    "filter",
+			NumArgs: interop.ExactArgs(1),
+			Args:    []interop.AdvArg{interop.RegexArg("regex")},
+			Value:   wordlist.filterFunc(false),
+		},
+		"exclude": &interop.AdvFunction{
+			Name:    "exclude",
+			NumArgs: interop.ExactArgs(1),
+			Args:    []interop.AdvArg{interop.RegexArg("regex")},
+			Value:   wordlist.filterFunc(true),
+		},
+		"words": &tengo.UserFunction{
+			Name: "words",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				return interop.GoStrSliceToTArray(wordlist.Words()), nil
+			},
+		},
+		"write": &interop.AdvFunction{
+			Name:    "write",
+			NumArgs: interop.ExactArgs(1),
+			Args:    []interop.AdvArg{interop.StrArg("path")},
+			Value:   wordlist.write,
+		},
+	}
+
+	wordlist.PropObject = types.PropObject{
+		ObjectMap: objectMap,
+		Properties: map[string]types.Property{
+			"len": {
+				Get: func() tengo.Object {
+					return interop.GoIntToTInt(wordlist.Len())
+				},
+			},
+		},
+	}
+
+	return wordlist
+}
+
+// tengoWordlistFrom creates a wordlist from the items
+// Represents 'ffuf.wordlist_from(items []string) Wordlist|error'
+func tengoWordlistFrom(args interop.ArgMap) (tengo.Object, error) {
+	items, _ := args.GetStringSlice("items")
+
+	wordlist, err := NewWordlist(items...)
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+
+	return makeWordlist(wordlist), nil
+}
+
+// tengoWordlistFiles creates a wordlist by merging the files
+// Represents 'ffuf.wordlist_files(paths ...string) Wordlist|error'
+func tengoWordlistFiles(args interop.ArgMap) (tengo.Object, error) {
+	paths, _ := args.GetStringSlice("paths")
+
+	wordlist, err := NewWordlist()
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+
+	err = wordlist.AddFiles(paths...)
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+
+	return makeWordlist(wordlist), nil
+}
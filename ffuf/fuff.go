@@ -5,15 +5,23 @@ import (
 
 	ffuf "github.com/analog-substance/ffufwrap"
 	"github.com/analog-substance/tengo/v2"
+	modhttp "github.com/analog-substance/tengomod/http"
+	"github.com/analog-substance/tengomod/interop"
 )
 
 type module struct {
-	ctx context.Context
+	getCompiled func() *tengo.Compiled
+	ctx         context.Context
 }
 
-func Module(ctx context.Context) map[string]tengo.Object {
+func Module(getCompiled func() *tengo.Compiled, ctx context.Context) map[string]tengo.Object {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
 	m := &module{
-		ctx: ctx,
+		getCompiled: getCompiled,
+		ctx:         ctx,
 	}
 
 	return map[string]tengo.Object{
@@ -21,6 +29,38 @@ func Module(ctx context.Context) map[string]tengo.Object {
 			Name:  "fuzzer",
 			Value: m.ffufFuzzer,
 		},
+		"native_fuzzer": &interop.AdvFunction{
+			Name:    "native_fuzzer",
+			NumArgs: interop.MaxArgs(1),
+			Args:    []interop.AdvArg{interop.CustomArg("client", &modhttp.HTTPClient{})},
+			Value:   m.tengoNativeFuzzer,
+		},
+		"wordlist_from": &interop.AdvFunction{
+			Name:    "wordlist_from",
+			NumArgs: interop.ExactArgs(1),
+			Args:    []interop.AdvArg{interop.StrSliceArg("items", false)},
+			Value:   tengoWordlistFrom,
+		},
+		"wordlist_files": &interop.AdvFunction{
+			Name:    "wordlist_files",
+			NumArgs: interop.MinArgs(1),
+			Args:    []interop.AdvArg{interop.StrSliceArg("paths", true)},
+			Value:   tengoWordlistFiles,
+		},
+		"campaign": &interop.AdvFunction{
+			Name:    "campaign",
+			NumArgs: interop.ArgRange(2, 3),
+			Args: []interop.AdvArg{
+				interop.CustomArg("fuzzer", &Fuzzer{}),
+				interop.StrSliceArg("targets", false),
+				interop.MapArg("options",
+					interop.IntArg("concurrency"),
+					interop.IntArg("global_rate"),
+					interop.StrArg("output_dir"),
+				),
+			},
+			Value: tengoCampaign,
+		},
 		"strategy": &tengo.ImmutableMap{
 			Value: map[string]tengo.Object{
 				"default": &tengo.String{
@@ -89,5 +129,5 @@ func Module(ctx context.Context) map[string]tengo.Object {
 }
 
 func (m *module) ffufFuzzer(args ...tengo.Object) (tengo.Object, error) {
-	return newFfufFuzzer(m.ctx), nil
+	return makeFfufFuzzer(m, ffuf.NewFuzzer(m.ctx)), nil
 }
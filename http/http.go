@@ -102,6 +102,29 @@ func Module() map[string]tengo.Object {
 			Args:    []interop.AdvArg{interop.StrArg("method"), interop.StrArg("url")},
 			Value:   newRequest,
 		},
+		"form": &interop.AdvFunction{
+			Name:    "form",
+			NumArgs: interop.ExactArgs(1),
+			Args:    []interop.AdvArg{interop.ObjectArg("values")},
+			Value:   form,
+		},
+		"file": &interop.AdvFunction{
+			Name:    "file",
+			NumArgs: interop.ExactArgs(1),
+			Args:    []interop.AdvArg{interop.StrArg("path")},
+			Value:   file,
+		},
+		"multipart": &interop.AdvFunction{
+			Name:    "multipart",
+			NumArgs: interop.ExactArgs(1),
+			Args: []interop.AdvArg{
+				interop.MapArg("form",
+					interop.ObjectArg("fields"),
+					interop.ObjectArg("files"),
+				),
+			},
+			Value: tengoMultipart,
+		},
 		"from_file": &interop.AdvFunction{
 			Name:    "from_file",
 			NumArgs: interop.ExactArgs(1),
@@ -0,0 +1,426 @@
+package http
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/analog-substance/tengo/v2"
+	"github.com/analog-substance/tengomod/interop"
+	"github.com/analog-substance/tengomod/types"
+)
+
+// HTTPBody is a request body built by the http module along with its content type. The body is
+// opened again for each attempt, so it can be replayed by retries and redirects.
+type HTTPBody struct {
+	types.PropObject
+	ContentType string
+	Length      int64
+	open        func() (io.ReadCloser, error)
+}
+
+func (b *HTTPBody) TypeName() string {
+	return "http-body"
+}
+
+// String should return a string representation of the type's value.
+func (b *HTTPBody) String() string {
+	return fmt.Sprintf("<http-body: %s>", b.ContentType)
+}
+
+// IsFalsy should return true if the value of the type should be considered
+// as falsy.
+func (b *HTTPBody) IsFalsy() bool {
+	return b.open == nil
+}
+
+// CanIterate should return whether the Object can be Iterated.
+func (b *HTTPBody) CanIterate() bool {
+	return false
+}
+
+// Open returns a new reader of the body
+func (b *HTTPBody) Open() (io.ReadCloser, error) {
+	return b.open()
+}
+
+// Apply sets the body of the request. The body is only opened once the request is sent, so requests
+// that are never sent don't leave files open. The content type is only set when contentType is true.
+func (b *HTTPBody) Apply(req *http.Request, contentType bool) error {
+	req.Body = &lazyBody{open: b.open}
+	req.ContentLength = b.Length
+	req.GetBody = func() (io.ReadCloser, error) {
+		return &lazyBody{open: b.open}, nil
+	}
+
+	if contentType {
+		req.Header.Set("Content-Type", b.ContentType)
+	}
+	return nil
+}
+
+// lazyBody opens the body on the first read
+type lazyBody struct {
+	open func() (io.ReadCloser, error)
+
+	mutex  sync.Mutex
+	body   io.ReadCloser
+	closed bool
+}
+
+func (b *lazyBody) Read(p []byte) (int, error) {
+	b.mutex.Lock()
+	if b.closed {
+		b.mutex.Unlock()
+		return 0, os.ErrClosed
+	}
+
+	if b.body == nil {
+		body, err := b.open()
+		if err != nil {
+			b.mutex.Unlock()
+			return 0, err
+		}
+		b.body = body
+	}
+	body := b.body
+	b.mutex.Unlock()
+
+	return body.Read(p)
+}
+
+// Close closes the body if it was opened. It can be called while another goroutine is reading it.
+func (b *lazyBody) Close() error {
+	b.mutex.Lock()
+	b.closed = true
+	body := b.body
+	b.mutex.Unlock()
+
+	if body == nil {
+		return nil
+	}
+	return body.Close()
+}
+
+// multipartFile is a file uploaded by a multipart body
+type multipartFile struct {
+	field       string
+	path        string
+	contentType string
+	size        int64
+}
+
+// multipartBody is a multipart form streamed from disk
+type multipartBody struct {
+	boundary string
+	fields   url.Values
+	files    []multipartFile
+}
+
+// write writes the form, using copyFile to write the content of each file
+func (m *multipartBody) write(w io.Writer, copyFile func(io.Writer, multipartFile) error) error {
+	writer := multipart.NewWriter(w)
+	err := writer.SetBoundary(m.boundary)
+	if err != nil {
+		return err
+	}
+
+	for _, field := range sortedKeys(m.fields) {
+		for _, value := range m.fields[field] {
+			err = writer.WriteField(field, value)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, file := range m.files {
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+			escapeQuotes(file.field), escapeQuotes(filepath.Base(file.path))))
+		header.Set("Content-Type", file.contentType)
+
+		part, err := writer.CreatePart(header)
+		if err != nil {
+			return err
+		}
+
+		err = copyFile(part, file)
+		if err != nil {
+			return err
+		}
+	}
+
+	return writer.Close()
+}
+
+// size returns the length of the form, counting the files by their size
+func (m *multipartBody) size() (int64, error) {
+	counter := &countWriter{}
+	err := m.write(counter, func(w io.Writer, file multipartFile) error {
+		counter.n += file.size
+		return nil
+	})
+	return counter.n, err
+}
+
+// open streams the form, reading the files as it is sent
+func (m *multipartBody) open() (io.ReadCloser, error) {
+	pr, pw := io.Pipe()
+	go func() {
+		err := m.write(pw, func(w io.Writer, file multipartFile) error {
+			f, err := os.Open(file.path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			_, err = io.Copy(w, f)
+			return err
+		})
+		pw.CloseWithError(err)
+	}()
+
+	return pr, nil
+}
+
+type countWriter struct {
+	n int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
+
+func sortedKeys(values url.Values) []string {
+	var keys []string
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// detectContentType detects the content type of the file from its extension, falling back to its content
+func detectContentType(path string) (string, error) {
+	if contentType := mime.TypeByExtension(filepath.Ext(path)); contentType != "" {
+		return contentType, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(file, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+
+	return http.DetectContentType(buf[:n]), nil
+}
+
+// toValues converts the map to values. Array values add a value for each item.
+func toValues(obj tengo.Object, name string) (url.Values, error) {
+	values := make(url.Values)
+	if obj == nil {
+		return values, nil
+	}
+
+	var objMap map[string]tengo.Object
+	switch o := obj.(type) {
+	case *tengo.Map:
+		objMap = o.Value
+	case *tengo.ImmutableMap:
+		objMap = o.Value
+	default:
+		return nil, tengo.ErrInvalidArgumentType{
+			Name:     name,
+			Expected: "map(compatible)",
+			Found:    obj.TypeName(),
+		}
+	}
+
+	for key, value := range objMap {
+		var items []tengo.Object
+		switch v := value.(type) {
+		case *tengo.Array:
+			items = v.Value
+		case *tengo.ImmutableArray:
+			items = v.Value
+		default:
+			items = []tengo.Object{v}
+		}
+
+		for _, item := range items {
+			s, ok := tengo.ToString(item)
+			if !ok {
+				return nil, tengo.ErrInvalidArgumentType{
+					Name:     fmt.Sprintf("%s.%s", name, key),
+					Expected: "string(compatible)",
+					Found:    item.TypeName(),
+				}
+			}
+			values.Add(key, s)
+		}
+	}
+
+	return values, nil
+}
+
+// NewFormBody creates a URL encoded form body
+func NewFormBody(values url.Values) *HTTPBody {
+	encoded := []byte(values.Encode())
+
+	return makeHTTPBody(&HTTPBody{
+		ContentType: "application/x-www-form-urlencoded",
+		Length:      int64(len(encoded)),
+		open: func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(encoded)), nil
+		},
+	})
+}
+
+// NewFileBody creates a body streaming the file from disk, with the content type detected from the file
+func NewFileBody(path string) (*HTTPBody, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	contentType, err := detectContentType(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return makeHTTPBody(&HTTPBody{
+		ContentType: contentType,
+		Length:      info.Size(),
+		open: func() (io.ReadCloser, error) {
+			return os.Open(path)
+		},
+	}), nil
+}
+
+// NewMultipartBody creates a multipart form body uploading the files of each field. The files are
+// streamed from disk when the request is sent.
+func NewMultipartBody(fields url.Values, files url.Values) (*HTTPBody, error) {
+	body := &multipartBody{
+		boundary: multipart.NewWriter(nil).Boundary(),
+		fields:   fields,
+	}
+
+	for _, field := range sortedKeys(files) {
+		for _, path := range files[field] {
+			info, err := os.Stat(path)
+			if err != nil {
+				return nil, err
+			}
+
+			contentType, err := detectContentType(path)
+			if err != nil {
+				return nil, err
+			}
+
+			body.files = append(body.files, multipartFile{
+				field:       field,
+				path:        path,
+				contentType: contentType,
+				size:        info.Size(),
+			})
+		}
+	}
+
+	length, err := body.size()
+	if err != nil {
+		return nil, err
+	}
+
+	return makeHTTPBody(&HTTPBody{
+		ContentType: "multipart/form-data; boundary=" + body.boundary,
+		Length:      length,
+		open:        body.open,
+	}), nil
+}
+
+func makeHTTPBody(body *HTTPBody) *HTTPBody {
+	body.PropObject = types.PropObject{
+		ObjectMap: map[string]tengo.Object{},
+		Properties: map[string]types.Property{
+			"content_type":   types.StaticProperty(interop.GoStrToTStr(body.ContentType)),
+			"content_length": types.StaticProperty(interop.GoIntToTInt(int(body.Length))),
+		},
+	}
+
+	return body
+}
+
+// form creates a URL encoded form body
+// Represents 'http.form(values map[string]string|[]string) HTTPBody|error'
+func form(args interop.ArgMap) (tengo.Object, error) {
+	obj, _ := args.GetObject("values")
+
+	values, err := toValues(obj, "values")
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+
+	return NewFormBody(values), nil
+}
+
+// file creates a body streaming the file from disk
+// Represents 'http.file(path string) HTTPBody|error'
+func file(args interop.ArgMap) (tengo.Object, error) {
+	path, _ := args.GetString("path")
+
+	body, err := NewFileBody(path)
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+
+	return body, nil
+}
+
+// tengoMultipart creates a multipart form body with the fields and the files of each field
+// Represents 'http.multipart(form {fields: map[string]string|[]string, files: map[string]string|[]string}) HTTPBody|error'
+func tengoMultipart(args interop.ArgMap) (tengo.Object, error) {
+	options, _ := args.GetArgMap("form")
+	fieldsObj, _ := options.GetObject("fields")
+	filesObj, _ := options.GetObject("files")
+
+	fields, err := toValues(fieldsObj, "form.fields")
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+
+	files, err := toValues(filesObj, "form.files")
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+
+	body, err := NewMultipartBody(fields, files)
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+
+	return body, nil
+}
@@ -1,10 +1,8 @@
 package http
 
 import (
-	"bytes"
 	"crypto/tls"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
 	"strings"
@@ -20,6 +18,8 @@ type HTTPClient struct {
 	Value   *http.Client
 	baseURL string
 	header  http.Header
+	retry   *RetryPolicy
+	limits  *Limits
 }
 
 func (c *HTTPClient) TypeName() string {
@@ -37,16 +37,57 @@ func (c *HTTPClient) IsFalsy() bool {
 	return c.Value == nil
 }
 
+// NewRequest creates a request relative to the base URL with the client's default headers
+func (c *HTTPClient) NewRequest(method string, u string) (*http.Request, error) {
+	return c.newRequest(method, u)
+}
+
 func (c *HTTPClient) SetBaseURL(u string) {
 	c.baseURL = strings.TrimRight(u, "/")
 }
 
 func (c *HTTPClient) transport() *http.Transport {
-	if c.Value.Transport == nil {
-		c.Value.Transport = &http.Transport{}
+	rt := &c.Value.Transport
+	if limited, ok := c.Value.Transport.(*limitedTransport); ok {
+		rt = &limited.base
+	}
+
+	if *rt == nil {
+		*rt = &http.Transport{}
 	}
 
-	return c.Value.Transport.(*http.Transport)
+	return (*rt).(*http.Transport)
+}
+
+// Clone copies the client. The copy shares the client's limits and cookie jar.
+func (c *HTTPClient) Clone() *HTTPClient {
+	httpClient := *c.Value
+
+	client := makeHTTPClient(&httpClient)
+	client.baseURL = c.baseURL
+	client.header = c.header.Clone()
+	client.retry = c.retry
+	client.limits = c.limits
+
+	// The transport is copied so configuring the clone's doesn't change the client's
+	transport := c.Value.Transport
+	if limited, ok := transport.(*limitedTransport); ok {
+		transport = limited.base
+	}
+	if t, ok := transport.(*http.Transport); ok {
+		transport = t.Clone()
+	}
+
+	client.Value.Transport = &limitedTransport{
+		base:   transport,
+		limits: client.limits,
+	}
+
+	return client
+}
+
+func (c *HTTPClient) clone(args ...tengo.Object) (tengo.Object, error) {
+	return c.Clone(), nil
 }
 
 func (c *HTTPClient) tlsConfig() *tls.Config {
@@ -84,18 +125,28 @@ func (c *HTTPClient) newBodyRequest(method string, args interop.ArgMap) (*http.R
 	u, _ := args.GetString("url")
 	contentType, _ := args.GetString("contentType")
 
-	body, err := c.getBodyArg(args)
+	req, err := c.newRequest(method, u)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := c.newRequest(method, u)
+	// Bodies built by the module set their own content type unless one is passed
+	if obj, ok := args.GetObject("body"); ok {
+		if body, ok := obj.(*HTTPBody); ok {
+			err = body.Apply(req, contentType == "")
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	body, err := c.getBodyArg(args)
 	if err != nil {
 		return nil, err
 	}
 
 	if body != nil {
-		req.Body = io.NopCloser(bytes.NewBuffer(body))
+		setBody(req, body)
 	}
 
 	if contentType != "" {
@@ -112,6 +163,9 @@ func (c *HTTPClient) getBodyArg(args interop.ArgMap) ([]byte, error) {
 		body, ok = args.GetByteSlice("body")
 		if !ok {
 			obj, _ := args.GetObject("body")
+			if _, ok := obj.(*HTTPBody); ok {
+				return nil, nil
+			}
 
 			var err error
 			body, err = json.Encode(obj)
@@ -125,12 +179,14 @@ func (c *HTTPClient) getBodyArg(args interop.ArgMap) ([]byte, error) {
 }
 
 func (c *HTTPClient) do(req *http.Request) (tengo.Object, error) {
-	resp, err := c.Value.Do(req)
+	resp, attempts, err := c.Do(req)
 	if err != nil {
 		return interop.GoErrToTErr(err), nil
 	}
 
-	return makeHTTPResponse(resp), nil
+	response := makeHTTPResponse(resp)
+	response.attempts = attempts
+	return response, nil
 }
 
 func (c *HTTPClient) tengoDo(args interop.ArgMap) (tengo.Object, error) {
@@ -244,10 +300,16 @@ func (c *HTTPClient) insecureSkipVerify(args ...tengo.Object) (tengo.Object, err
 	return c, nil
 }
 
+// NewHTTPClient creates a tengo object wrapper for the client
+func NewHTTPClient(c *http.Client) *HTTPClient {
+	return makeHTTPClient(c)
+}
+
 func makeHTTPClient(c *http.Client) *HTTPClient {
 	client := &HTTPClient{
 		Value:  c,
 		header: make(http.Header),
+		limits: &Limits{},
 	}
 
 	objectMap := map[string]tengo.Object{
@@ -333,6 +395,78 @@ func makeHTTPClient(c *http.Client) *HTTPClient {
 			Args:    []interop.AdvArg{interop.StrArg("token")},
 			Value:   client.token,
 		},
+		"retry": &interop.AdvFunction{
+			Name:    "retry",
+			NumArgs: interop.MaxArgs(1),
+			Args: []interop.AdvArg{
+				interop.MapArg("policy",
+					interop.IntArg("max"),
+					interop.StrArg("backoff"),
+					interop.StrArg("jitter"),
+					interop.StrArg("max_delay"),
+					interop.IntSliceArg("on_status", false),
+					interop.BoolArg("on_error"),
+				),
+			},
+			Value: client.setRetry,
+		},
+		"rate_limit": &interop.AdvFunction{
+			Name:    "rate_limit",
+			NumArgs: interop.ArgRange(1, 3),
+			Args:    []interop.AdvArg{interop.IntArg("rps"), interop.IntArg("burst"), interop.BoolArg("per_host")},
+			Value:   client.rateLimit,
+		},
+		"max_concurrency": &interop.AdvFunction{
+			Name:    "max_concurrency",
+			NumArgs: interop.ArgRange(1, 2),
+			Args:    []interop.AdvArg{interop.IntArg("n"), interop.BoolArg("per_host")},
+			Value:   client.maxConcurrency,
+		},
+		"clone": &tengo.UserFunction{
+			Name:  "clone",
+			Value: client.clone,
+		},
+		"cookie_jar": &tengo.UserFunction{
+			Name:  "cookie_jar",
+			Value: client.cookieJar,
+		},
+		"cookies": &interop.AdvFunction{
+			Name:    "cookies",
+			NumArgs: interop.ExactArgs(1),
+			Args:    []interop.AdvArg{interop.StrArg("url")},
+			Value:   client.cookies,
+		},
+		"set_cookie": &interop.AdvFunction{
+			Name:    "set_cookie",
+			NumArgs: interop.ExactArgs(3),
+			Args:    []interop.AdvArg{interop.StrArg("url"), interop.StrArg("name"), interop.StrArg("value")},
+			Value:   client.setCookie,
+		},
+		"save_session": &interop.AdvFunction{
+			Name:    "save_session",
+			NumArgs: interop.ExactArgs(1),
+			Args:    []interop.AdvArg{interop.StrArg("path")},
+			Value:   client.saveSession,
+		},
+		"load_session": &interop.AdvFunction{
+			Name:    "load_session",
+			NumArgs: interop.ExactArgs(1),
+			Args:    []interop.AdvArg{interop.StrArg("path")},
+			Value:   client.loadSession,
+		},
+		"download": &interop.AdvFunction{
+			Name:    "download",
+			NumArgs: interop.ArgRange(2, 3),
+			Args: []interop.AdvArg{
+				interop.StrArg("url"),
+				interop.StrArg("path"),
+				interop.MapArg("options",
+					interop.BoolArg("resume"),
+					interop.IntArg("max_size"),
+				),
+			},
+			Value: client.download,
+		},
 		"disable_redirects": &tengo.UserFunction{
 			Name:  "disable_redirects",
 			Value: client.disableRedirects,
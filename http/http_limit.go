@@ -0,0 +1,258 @@
+package http
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/analog-substance/tengo/v2"
+	"github.com/analog-substance/tengomod/interop"
+)
+
+// rateLimiter is a token bucket allowing rps requests per second with bursts of up to burst requests
+type rateLimiter struct {
+	mutex  sync.Mutex
+	rps    float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rps int, burst int) *rateLimiter {
+	return &rateLimiter{
+		rps:    float64(rps),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// wait reserves a token, waiting until it is available. Tokens can go negative so waiting callers are
+// served in order.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	l.mutex.Lock()
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rps)
+	l.last = now
+	l.tokens--
+
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rps * float64(time.Second))
+	}
+	l.mutex.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.mutex.Lock()
+		l.tokens++
+		l.mutex.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Limits are the rate and concurrency limits of a client, shared by its clones. Per host limits track
+// each host separately.
+type Limits struct {
+	mutex sync.Mutex
+
+	rps         int
+	burst       int
+	ratePerHost bool
+	rates       map[string]*rateLimiter
+
+	concurrency        int
+	concurrencyPerHost bool
+	semaphores         map[string]chan struct{}
+}
+
+// SetRate limits the requests per second, allowing bursts of up to burst requests. A rate of 0 removes
+// the limit.
+func (l *Limits) SetRate(rps int, burst int, perHost bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.rps = rps
+	l.burst = max(burst, 1)
+	l.ratePerHost = perHost
+	l.rates = make(map[string]*rateLimiter)
+}
+
+// SetConcurrency limits the requests in flight. A limit of 0 removes it.
+func (l *Limits) SetConcurrency(n int, perHost bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.concurrency = n
+	l.concurrencyPerHost = perHost
+	l.semaphores = make(map[string]chan struct{})
+}
+
+func (l *Limits) limiters(host string) (*rateLimiter, chan struct{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	var limiter *rateLimiter
+	if l.rps > 0 {
+		key := ""
+		if l.ratePerHost {
+			key = host
+		}
+
+		limiter = l.rates[key]
+		if limiter == nil {
+			limiter = newRateLimiter(l.rps, l.burst)
+			l.rates[key] = limiter
+		}
+	}
+
+	var semaphore chan struct{}
+	if l.concurrency > 0 {
+		key := ""
+		if l.concurrencyPerHost {
+			key = host
+		}
+
+		semaphore = l.semaphores[key]
+		if semaphore == nil {
+			semaphore = make(chan struct{}, l.concurrency)
+			l.semaphores[key] = semaphore
+		}
+	}
+
+	return limiter, semaphore
+}
+
+// acquire waits until a request to the host is allowed, returning the function to call once it is done
+func (l *Limits) acquire(ctx context.Context, host string) (func(), error) {
+	limiter, semaphore := l.limiters(host)
+
+	release := func() {}
+	if semaphore != nil {
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		release = func() {
+			<-semaphore
+		}
+	}
+
+	if limiter != nil {
+		err := limiter.wait(ctx)
+		if err != nil {
+			release()
+			return nil, err
+		}
+	}
+
+	return release, nil
+}
+
+// limitedTransport enforces the limits on each request sent by the base transport, so they also apply
+// to redirects, retries and copies of the client. A request holds its concurrency slot until its
+// response's body is read to the end or closed.
+type limitedTransport struct {
+	base   http.RoundTripper
+	limits *Limits
+}
+
+func (t *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	release, err := t.limits.acquire(req.Context(), req.URL.Host)
+	if err != nil {
+		// RoundTrip must close the request's body, even on errors
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	resp.Body = &releasingBody{
+		ReadCloser: resp.Body,
+		release:    release,
+	}
+	return resp, nil
+}
+
+// releasingBody releases the concurrency slot of its request once it is read to the end or closed
+type releasingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releasingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.once.Do(b.release)
+	}
+	return n, err
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+// limitTransport wraps the client's transport to enforce its limits
+func (c *HTTPClient) limitTransport() {
+	if _, ok := c.Value.Transport.(*limitedTransport); ok {
+		return
+	}
+
+	c.Value.Transport = &limitedTransport{
+		base:   c.Value.Transport,
+		limits: c.limits,
+	}
+}
+
+// rateLimit limits the rate of requests of the client and its clones
+// Represents 'client.rate_limit(rps int, burst int?, per_host bool?) HTTPClient'
+func (c *HTTPClient) rateLimit(args interop.ArgMap) (tengo.Object, error) {
+	rps, _ := args.GetInt("rps")
+	burst, ok := args.GetInt("burst")
+	if !ok {
+		burst = 1
+	}
+	perHost, _ := args.GetBool("per_host")
+
+	c.limits.SetRate(rps, burst, perHost)
+	c.limitTransport()
+	return c, nil
+}
+
+// maxConcurrency limits the requests in flight of the client and its clones
+// Represents 'client.max_concurrency(n int, per_host bool?) HTTPClient'
+func (c *HTTPClient) maxConcurrency(args interop.ArgMap) (tengo.Object, error) {
+	n, _ := args.GetInt("n")
+	perHost, _ := args.GetBool("per_host")
+
+	c.limits.SetConcurrency(n, perHost)
+	c.limitTransport()
+	return c, nil
+}
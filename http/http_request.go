@@ -1,7 +1,6 @@
 package http
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"io"
@@ -64,9 +63,11 @@ func (r *HTTPRequest) clone(_ ...tengo.Object) (tengo.Object, error) {
 	req := r.Value.Clone(context.Background())
 
 	// Make 2 copies of body
-	body, _ := io.ReadAll(r.Value.Body)
-	r.Value.Body = io.NopCloser(bytes.NewBuffer(body))
-	req.Body = io.NopCloser(bytes.NewBuffer(body))
+	if r.Value.Body != nil {
+		body, _ := io.ReadAll(r.Value.Body)
+		setBody(r.Value, body)
+		setBody(req, body)
+	}
 
 	return makeHTTPRequest(req), nil
 }
@@ -141,12 +142,22 @@ func makeHTTPRequest(r *http.Request) *HTTPRequest {
 		},
 		"body": {
 			Get: func() tengo.Object {
+				if request.Value.Body == nil {
+					return &tengo.Bytes{}
+				}
+
+				// The body is reset so reading it doesn't consume it
 				body, _ := io.ReadAll(request.Value.Body)
+				setBody(request.Value, body)
 				return &tengo.Bytes{
 					Value: body,
 				}
 			},
 			Set: func(o tengo.Object) error {
+				if body, ok := o.(*HTTPBody); ok {
+					return body.Apply(request.Value, true)
+				}
+
 				body, ok := tengo.ToByteSlice(o)
 				if !ok {
 					var err error
@@ -156,8 +167,7 @@ func makeHTTPRequest(r *http.Request) *HTTPRequest {
 					}
 				}
 
-				request.Value.ContentLength = int64(len(body))
-				request.Value.Body = io.NopCloser(bytes.NewBuffer(body))
+				setBody(request.Value, body)
 				return nil
 			},
 		},
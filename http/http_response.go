@@ -12,8 +12,9 @@ import (
 
 type HTTPResponse struct {
 	types.PropObject
-	Value *http.Response
-	body  []byte
+	Value    *http.Response
+	body     []byte
+	attempts int
 }
 
 func (r *HTTPResponse) TypeName() string {
@@ -32,8 +33,9 @@ func (r *HTTPResponse) IsFalsy() bool {
 }
 
 func (r *HTTPResponse) ensureBody() ([]byte, error) {
-	if len(r.body) == 0 {
+	if r.body == nil {
 		body, err := io.ReadAll(r.Value.Body)
+		r.Value.Body.Close()
 		if err != nil && len(body) == 0 {
 			return nil, err
 		}
@@ -86,7 +88,8 @@ func (r *HTTPResponse) isRedirect(args ...tengo.Object) (tengo.Object, error) {
 
 func makeHTTPResponse(r *http.Response) *HTTPResponse {
 	response := &HTTPResponse{
-		Value: r,
+		Value:    r,
+		attempts: 1,
 	}
 
 	objectMap := map[string]tengo.Object{
@@ -106,6 +109,16 @@ func makeHTTPResponse(r *http.Response) *HTTPResponse {
 			Name:  "is_success",
 			Value: response.isSuccessCode,
 		},
+		"save": &interop.AdvFunction{
+			Name:    "save",
+			NumArgs: interop.ArgRange(1, 2),
+			Args:    []interop.AdvArg{interop.StrArg("path"), interop.IntArg("max_size")},
+			Value:   response.save,
+		},
+		"lines": &tengo.UserFunction{
+			Name:  "lines",
+			Value: response.lines,
+		},
 		"is_redirect": &tengo.UserFunction{
 			Name:  "is_redirect",
 			Value: response.isRedirect,
@@ -118,6 +131,11 @@ func makeHTTPResponse(r *http.Response) *HTTPResponse {
 				return makeHTTPHeader(response.Value.Header)
 			},
 		},
+		"attempts": {
+			Get: func() tengo.Object {
+				return interop.GoIntToTInt(response.attempts)
+			},
+		},
 		"content_length": types.StaticProperty(interop.GoIntToTInt(int(r.ContentLength))),
 		"status":         types.StaticProperty(interop.GoStrToTStr(r.Status)),
 		"status_code":    types.StaticProperty(interop.GoIntToTInt(r.StatusCode)),
@@ -0,0 +1,206 @@
+package http
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/analog-substance/tengo/v2"
+	"github.com/analog-substance/tengomod/interop"
+)
+
+const (
+	defaultRetryMax      int           = 3
+	defaultRetryBackoff  time.Duration = 500 * time.Millisecond
+	defaultRetryMaxDelay time.Duration = 30 * time.Second
+)
+
+var (
+	defaultRetryStatuses []int = []int{
+		http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	}
+
+	// idempotentMethods are the methods that can safely be sent more than once
+	idempotentMethods []string = []string{
+		http.MethodGet,
+		http.MethodHead,
+		http.MethodOptions,
+		http.MethodTrace,
+		http.MethodPut,
+		http.MethodDelete,
+	}
+)
+
+// RetryPolicy configures how requests of idempotent methods are retried. The backoff doubles after each
+// attempt and up to jitter is randomly added to it, without exceeding the max delay.
+type RetryPolicy struct {
+	Max      int
+	Backoff  time.Duration
+	Jitter   time.Duration
+	MaxDelay time.Duration
+	OnStatus []int
+	OnError  bool
+}
+
+// delay returns how long to wait before the next attempt. The response's Retry-After header takes
+// precedence over the backoff, and false is returned when it asks to wait longer than the max delay.
+func (p *RetryPolicy) delay(attempt int, resp *http.Response) (time.Duration, bool) {
+	if resp != nil {
+		if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			return retryAfter, retryAfter <= p.MaxDelay
+		}
+	}
+
+	// The backoff is doubled one attempt at a time so it can't overflow
+	delay := p.Backoff
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	if p.Jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(p.Jitter)))
+	}
+	return min(delay, p.MaxDelay), true
+}
+
+// shouldRetry returns whether the result of the attempt must be retried
+func (p *RetryPolicy) shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return p.OnError
+	}
+	return slices.Contains(p.OnStatus, resp.StatusCode)
+}
+
+// parseRetryAfter parses the Retry-After header, which is either a number of seconds or a date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0), true
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	return max(time.Until(date), 0), true
+}
+
+// setBody sets the request's body, allowing it to be replayed by retries and redirects
+func setBody(req *http.Request, body []byte) {
+	req.ContentLength = int64(len(body))
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+}
+
+// Do sends the request, retrying it according to the client's retry policy. The number of attempts made
+// is returned along with the last response, which is returned as is once the attempts run out or the
+// server asks to wait longer than the max delay.
+func (c *HTTPClient) Do(req *http.Request) (*http.Response, int, error) {
+	policy := c.retry
+	if policy == nil || policy.Max <= 0 || !slices.Contains(idempotentMethods, req.Method) {
+		resp, err := c.Value.Do(req)
+		return resp, 1, err
+	}
+
+	// Bodies that can't be replayed are buffered before the first attempt
+	if req.Body != nil && req.GetBody == nil {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, 0, err
+		}
+		setBody(req, body)
+	}
+
+	attempt := 1
+	for {
+		resp, err := c.Value.Do(req)
+		if attempt > policy.Max || !policy.shouldRetry(resp, err) {
+			return resp, attempt, err
+		}
+
+		delay, ok := policy.delay(attempt, resp)
+		if !ok {
+			return resp, attempt, err
+		}
+
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, attempt, req.Context().Err()
+		}
+
+		if req.GetBody != nil {
+			req.Body, err = req.GetBody()
+			if err != nil {
+				return nil, attempt, err
+			}
+		}
+		attempt++
+	}
+}
+
+// setRetry sets the policy retrying the requests of idempotent methods that fail or get one of the
+// retried statuses
+// Represents 'client.retry(policy {max: int, backoff: string, jitter: string, max_delay: string, on_status: []int, on_error: bool}?) HTTPClient|error'
+func (c *HTTPClient) setRetry(args interop.ArgMap) (tengo.Object, error) {
+	options, _ := args.GetArgMap("policy")
+
+	policy := &RetryPolicy{
+		Max:      defaultRetryMax,
+		Backoff:  defaultRetryBackoff,
+		MaxDelay: defaultRetryMaxDelay,
+		OnStatus: defaultRetryStatuses,
+		OnError:  true,
+	}
+
+	if maxRetries, ok := options.GetInt("max"); ok {
+		policy.Max = maxRetries
+	}
+
+	for name, value := range map[string]*time.Duration{
+		"backoff":   &policy.Backoff,
+		"jitter":    &policy.Jitter,
+		"max_delay": &policy.MaxDelay,
+	} {
+		duration, ok := options.GetString(name)
+		if !ok {
+			continue
+		}
+
+		parsed, err := time.ParseDuration(duration)
+		if err != nil {
+			return interop.GoErrToTErr(err), nil
+		}
+		*value = parsed
+	}
+
+	if statuses, ok := options.GetIntSlice("on_status"); ok {
+		policy.OnStatus = statuses
+	}
+
+	if onError, ok := options.GetBool("on_error"); ok {
+		policy.OnError = onError
+	}
+
+	c.retry = policy
+	return c, nil
+}
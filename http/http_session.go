@@ -0,0 +1,309 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/analog-substance/tengo/v2"
+	"github.com/analog-substance/tengomod/interop"
+)
+
+// sessionCookie is a cookie saved in a session file along with the URL that set it
+type sessionCookie struct {
+	URL      string    `json:"url"`
+	Name     string    `json:"name"`
+	Value    string    `json:"value"`
+	Domain   string    `json:"domain,omitempty"`
+	Path     string    `json:"path,omitempty"`
+	Expires  time.Time `json:"expires"`
+	Secure   bool      `json:"secure,omitempty"`
+	HttpOnly bool      `json:"http_only,omitempty"`
+}
+
+// key identifies the cookie like the jar does, by its domain, or host for host only cookies, path and name
+func (c sessionCookie) key() string {
+	domain := c.Domain
+	if domain == "" {
+		if u, err := url.Parse(c.URL); err == nil {
+			domain = u.Hostname()
+		}
+	}
+	return domain + "\x00" + c.Path + "\x00" + c.Name
+}
+
+func (c sessionCookie) expired() bool {
+	return !c.Expires.IsZero() && c.Expires.Before(time.Now())
+}
+
+// defaultCookiePath returns the path of cookies set without one, which is the directory of the URL's path
+func defaultCookiePath(path string) string {
+	i := strings.LastIndex(path, "/")
+	if i <= 0 {
+		return "/"
+	}
+	return path[:i]
+}
+
+// Session is the cookies and default headers of a client saved between script runs
+type Session struct {
+	Headers http.Header     `json:"headers"`
+	Cookies []sessionCookie `json:"cookies"`
+}
+
+// CookieJar is a cookie jar keeping track of the cookies set, as the standard jar can't list them
+type CookieJar struct {
+	*cookiejar.Jar
+
+	mutex   sync.Mutex
+	cookies map[string]sessionCookie
+}
+
+// NewCookieJar creates an empty cookie jar
+func NewCookieJar() (*CookieJar, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CookieJar{
+		Jar:     jar,
+		cookies: make(map[string]sessionCookie),
+	}, nil
+}
+
+// SetCookies stores the cookies set by the URL
+func (j *CookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.Jar.SetCookies(u, cookies)
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	origin := (&url.URL{Scheme: u.Scheme, Host: u.Host}).String()
+	for _, cookie := range cookies {
+		saved := sessionCookie{
+			URL:      origin,
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Domain:   cookie.Domain,
+			Path:     cookie.Path,
+			Expires:  cookie.Expires,
+			Secure:   cookie.Secure,
+			HttpOnly: cookie.HttpOnly,
+		}
+
+		if !strings.HasPrefix(saved.Path, "/") {
+			saved.Path = defaultCookiePath(u.Path)
+		}
+
+		if cookie.MaxAge < 0 {
+			delete(j.cookies, saved.key())
+			continue
+		}
+
+		if cookie.MaxAge > 0 {
+			saved.Expires = time.Now().Add(time.Duration(cookie.MaxAge) * time.Second)
+		}
+
+		j.cookies[saved.key()] = saved
+	}
+}
+
+// savedCookies returns the cookies that haven't expired
+func (j *CookieJar) savedCookies() []sessionCookie {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	var cookies []sessionCookie
+	for key, cookie := range j.cookies {
+		if cookie.expired() {
+			delete(j.cookies, key)
+			continue
+		}
+		cookies = append(cookies, cookie)
+	}
+
+	sort.Slice(cookies, func(i, k int) bool {
+		return cookies[i].key() < cookies[k].key()
+	})
+	return cookies
+}
+
+// restore sets the saved cookies again
+func (j *CookieJar) restore(cookies []sessionCookie) error {
+	for _, cookie := range cookies {
+		if cookie.expired() {
+			continue
+		}
+
+		u, err := url.Parse(cookie.URL)
+		if err != nil {
+			return err
+		}
+
+		j.SetCookies(u, []*http.Cookie{{
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Domain:   cookie.Domain,
+			Path:     cookie.Path,
+			Expires:  cookie.Expires,
+			Secure:   cookie.Secure,
+			HttpOnly: cookie.HttpOnly,
+		}})
+	}
+
+	return nil
+}
+
+// EnableCookieJar sets a cookie jar on the client if it doesn't have one
+func (c *HTTPClient) EnableCookieJar() (*CookieJar, error) {
+	if jar, ok := c.Value.Jar.(*CookieJar); ok {
+		return jar, nil
+	}
+
+	jar, err := NewCookieJar()
+	if err != nil {
+		return nil, err
+	}
+
+	c.Value.Jar = jar
+	return jar, nil
+}
+
+// SaveSession writes the client's cookies and default headers to the file
+func (c *HTTPClient) SaveSession(path string) error {
+	session := Session{
+		Headers: c.header,
+	}
+
+	if jar, ok := c.Value.Jar.(*CookieJar); ok {
+		session.Cookies = jar.savedCookies()
+	}
+
+	content, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, content, 0600)
+}
+
+// LoadSession restores the cookies and default headers saved to the file, enabling the cookie jar
+func (c *HTTPClient) LoadSession(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var session Session
+	err = json.Unmarshal(content, &session)
+	if err != nil {
+		return err
+	}
+
+	jar, err := c.EnableCookieJar()
+	if err != nil {
+		return err
+	}
+
+	err = jar.restore(session.Cookies)
+	if err != nil {
+		return err
+	}
+
+	for key, values := range session.Headers {
+		c.header[key] = values
+	}
+
+	return nil
+}
+
+// cookieJar enables the cookie jar, so cookies set by responses are sent with the next requests
+// Represents 'client.cookie_jar() HTTPClient|error'
+func (c *HTTPClient) cookieJar(args ...tengo.Object) (tengo.Object, error) {
+	_, err := c.EnableCookieJar()
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+
+	return c, nil
+}
+
+// cookies returns the cookies sent to the URL
+// Represents 'client.cookies(url string) []{name: string, value: string}|error'
+func (c *HTTPClient) cookies(args interop.ArgMap) (tengo.Object, error) {
+	u, _ := args.GetString("url")
+
+	req, err := c.newRequest(http.MethodGet, u)
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+
+	var cookies []tengo.Object
+	if c.Value.Jar != nil {
+		for _, cookie := range c.Value.Jar.Cookies(req.URL) {
+			cookies = append(cookies, interop.GoStrMapStrToTImmutMap(map[string]string{
+				"name":  cookie.Name,
+				"value": cookie.Value,
+			}))
+		}
+	}
+
+	return &tengo.ImmutableArray{Value: cookies}, nil
+}
+
+// setCookie sets a cookie sent to the URL, enabling the cookie jar
+// Represents 'client.set_cookie(url string, name string, value string) HTTPClient|error'
+func (c *HTTPClient) setCookie(args interop.ArgMap) (tengo.Object, error) {
+	u, _ := args.GetString("url")
+	name, _ := args.GetString("name")
+	value, _ := args.GetString("value")
+
+	req, err := c.newRequest(http.MethodGet, u)
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+
+	jar, err := c.EnableCookieJar()
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+
+	jar.SetCookies(req.URL, []*http.Cookie{{
+		Name:  name,
+		Value: value,
+	}})
+	return c, nil
+}
+
+// saveSession writes the cookies and default headers to the file
+// Represents 'client.save_session(path string) error'
+func (c *HTTPClient) saveSession(args interop.ArgMap) (tengo.Object, error) {
+	path, _ := args.GetString("path")
+
+	err := c.SaveSession(path)
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+
+	return nil, nil
+}
+
+// loadSession restores the cookies and default headers saved to the file
+// Represents 'client.load_session(path string) HTTPClient|error'
+func (c *HTTPClient) loadSession(args interop.ArgMap) (tengo.Object, error) {
+	path, _ := args.GetString("path")
+
+	err := c.LoadSession(path)
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+
+	return c, nil
+}
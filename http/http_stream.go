@@ -0,0 +1,330 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/analog-substance/tengo/v2"
+	"github.com/analog-substance/tengomod/interop"
+	"github.com/analog-substance/tengomod/types"
+)
+
+// ErrMaxSize is returned when a body is larger than the max size
+var ErrMaxSize = errors.New("response body exceeds the max size")
+
+// copyMax copies src to dst, returning ErrMaxSize once more than maxSize bytes are copied. A maxSize of 0
+// means no limit.
+func copyMax(dst io.Writer, src io.Reader, maxSize int64) (int64, error) {
+	if maxSize <= 0 {
+		return io.Copy(dst, src)
+	}
+
+	n, err := io.Copy(dst, io.LimitReader(src, maxSize+1))
+	if err != nil {
+		return n, err
+	}
+
+	if n > maxSize {
+		return n, ErrMaxSize
+	}
+	return n, nil
+}
+
+// bodyReader returns the reader of the response body, which is the buffered body once it was read
+func (r *HTTPResponse) bodyReader() io.Reader {
+	if r.body != nil {
+		return bytes.NewReader(r.body)
+	}
+	return r.Value.Body
+}
+
+// Save streams the body to the file, returning the number of bytes written. The file is removed when
+// the body is larger than maxSize, unless maxSize is 0.
+func (r *HTTPResponse) Save(path string, maxSize int64) (int64, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := copyMax(file, r.bodyReader(), maxSize)
+	r.Value.Body.Close()
+
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if errors.Is(err, ErrMaxSize) {
+		os.Remove(path)
+		return n, fmt.Errorf("%w of %d bytes", ErrMaxSize, maxSize)
+	}
+	return n, err
+}
+
+// save streams the body to the file
+// Represents 'response.save(path string, max_size int?) int|error'
+func (r *HTTPResponse) save(args interop.ArgMap) (tengo.Object, error) {
+	path, _ := args.GetString("path")
+	maxSize, _ := args.GetInt("max_size")
+
+	n, err := r.Save(path, int64(maxSize))
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+
+	return interop.GoIntToTInt(int(n)), nil
+}
+
+// HTTPLines iterates over the lines of a response body, reading it as it is iterated. The error that
+// ended the iteration early, if any, is available as err.
+type HTTPLines struct {
+	types.PropObject
+	reader *bufio.Reader
+	closer io.Closer
+	closed bool
+	err    error
+}
+
+func (l *HTTPLines) TypeName() string {
+	return "http-lines"
+}
+
+// String should return a string representation of the type's value.
+func (l *HTTPLines) String() string {
+	return "<http-lines>"
+}
+
+// IsFalsy should return true if the value of the type should be considered
+// as falsy.
+func (l *HTTPLines) IsFalsy() bool {
+	return false
+}
+
+// CanIterate should return whether the Object can be Iterated.
+func (l *HTTPLines) CanIterate() bool {
+	return true
+}
+
+// Iterate should return an Iterator for the type. The lines are only read once, so iterating again
+// continues after the last line read.
+func (l *HTTPLines) Iterate() tengo.Iterator {
+	return &HTTPLinesIterator{lines: l, i: -1}
+}
+
+type HTTPLinesIterator struct {
+	tengo.ObjectImpl
+	lines *HTTPLines
+	line  string
+	i     int
+}
+
+// TypeName returns the name of the type.
+func (i *HTTPLinesIterator) TypeName() string {
+	return "http-lines-iterator"
+}
+
+func (i *HTTPLinesIterator) String() string {
+	return "<http-lines-iterator>"
+}
+
+// IsFalsy returns true if the value of the type is falsy.
+func (i *HTTPLinesIterator) IsFalsy() bool {
+	return true
+}
+
+// Equals returns true if the value of the type is equal to the value of
+// another object.
+func (i *HTTPLinesIterator) Equals(tengo.Object) bool {
+	return false
+}
+
+// Copy returns a copy of the type.
+func (i *HTTPLinesIterator) Copy() tengo.Object {
+	return &HTTPLinesIterator{lines: i.lines, line: i.line, i: i.i}
+}
+
+// Next returns true if there are more elements to iterate. The body is closed after the last line, and
+// errors other than the end of the body are kept as the lines' err. Once the body is closed, there are
+// no more lines.
+func (i *HTTPLinesIterator) Next() bool {
+	if i.lines.closed {
+		return false
+	}
+
+	line, err := i.lines.reader.ReadString('\n')
+	if line == "" && err != nil {
+		if err != io.EOF {
+			i.lines.err = err
+		}
+		i.lines.closer.Close()
+		i.lines.closed = true
+		return false
+	}
+
+	i.line = strings.TrimRight(line, "\r\n")
+	i.i++
+	return true
+}
+
+// Key returns the key or index value of the current element.
+func (i *HTTPLinesIterator) Key() tengo.Object {
+	return interop.GoIntToTInt(i.i)
+}
+
+// Value returns the value of the current element.
+func (i *HTTPLinesIterator) Value() tengo.Object {
+	return interop.GoStrToTStr(i.line)
+}
+
+// lines returns an iterator over the lines of the body that reads it lazily
+// Represents 'response.lines() HTTPLines'
+func (r *HTTPResponse) lines(args ...tengo.Object) (tengo.Object, error) {
+	lines := &HTTPLines{
+		reader: bufio.NewReader(r.bodyReader()),
+		closer: r.Value.Body,
+	}
+
+	lines.PropObject = types.PropObject{
+		ObjectMap: map[string]tengo.Object{},
+		Properties: map[string]types.Property{
+			"err": {
+				Get: func() tengo.Object {
+					if lines.err == nil {
+						return tengo.UndefinedValue
+					}
+					return interop.GoErrToTErr(lines.err)
+				},
+			},
+		},
+	}
+
+	return lines, nil
+}
+
+// parseCompleteLength parses the complete length of an unsatisfied Content-Range, like "bytes */1234"
+func parseCompleteLength(contentRange string) (int64, bool) {
+	length, ok := strings.CutPrefix(contentRange, "bytes */")
+	if !ok {
+		return 0, false
+	}
+
+	n, err := strconv.ParseInt(length, 10, 64)
+	return n, err == nil
+}
+
+// Download streams the URL to the file, returning the number of bytes written and whether the download
+// resumed a partial file. When resume is true and the file exists, only the rest of the file is
+// requested. The file is replaced when the server doesn't support range requests, and an error is
+// returned when the server can't satisfy the range and the file doesn't have the size of the content.
+func (c *HTTPClient) Download(u string, path string, resume bool, maxSize int64) (int64, bool, error) {
+	req, err := c.newRequest(http.MethodGet, u)
+	if err != nil {
+		return 0, false, err
+	}
+
+	var offset int64
+	if resume {
+		info, err := os.Stat(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return 0, false, err
+		}
+
+		if info != nil && info.Size() > 0 {
+			offset = info.Size()
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		}
+	}
+
+	resp, _, err := c.Do(req)
+	if err != nil {
+		return 0, false, err
+	}
+	defer resp.Body.Close()
+
+	appending := false
+	switch {
+	case offset > 0 && resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		length, ok := parseCompleteLength(resp.Header.Get("Content-Range"))
+		if !ok {
+			return 0, false, fmt.Errorf("unexpected content range: %s", resp.Header.Get("Content-Range"))
+		}
+
+		if length != offset {
+			return 0, false, fmt.Errorf("file has %d bytes but the content has %d bytes", offset, length)
+		}
+
+		// The partial file is already complete
+		return 0, true, nil
+	case offset > 0 && resp.StatusCode == http.StatusPartialContent:
+		if !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)) {
+			return 0, false, fmt.Errorf("unexpected content range: %s", resp.Header.Get("Content-Range"))
+		}
+		appending = true
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		return 0, false, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	limit := maxSize
+	if appending {
+		flags = os.O_WRONLY | os.O_APPEND
+		if maxSize > 0 {
+			limit = maxSize - offset
+			if limit <= 0 {
+				return 0, false, fmt.Errorf("%w of %d bytes", ErrMaxSize, maxSize)
+			}
+		}
+	}
+
+	file, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return 0, false, err
+	}
+
+	n, err := copyMax(file, resp.Body, limit)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if errors.Is(err, ErrMaxSize) {
+		// Only the partial file that was resumed is kept
+		if appending {
+			os.Truncate(path, offset)
+		} else {
+			os.Remove(path)
+		}
+		return 0, false, fmt.Errorf("%w of %d bytes", ErrMaxSize, maxSize)
+	}
+
+	return n, appending, err
+}
+
+// download streams the URL to the file
+// Represents 'client.download(url string, path string, options {resume: bool, max_size: int}?) {written: int, resumed: bool}|error'
+func (c *HTTPClient) download(args interop.ArgMap) (tengo.Object, error) {
+	u, _ := args.GetString("url")
+	path, _ := args.GetString("path")
+	options, _ := args.GetArgMap("options")
+	resume, _ := options.GetBool("resume")
+	maxSize, _ := options.GetInt("max_size")
+
+	written, resumed, err := c.Download(u, path, resume, int64(maxSize))
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+
+	return &tengo.ImmutableMap{
+		Value: map[string]tengo.Object{
+			"written": interop.GoIntToTInt(int(written)),
+			"resumed": interop.GoBoolToTBool(resumed),
+		},
+	}, nil
+}
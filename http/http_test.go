@@ -1,10 +1,19 @@
 package http_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/analog-substance/tengo/v2/require"
 	tengohttp "github.com/analog-substance/tengomod/http"
@@ -33,7 +42,7 @@ func testHeaders(method string) http.Header {
 	}
 }
 
-func newServer() http.Server {
+func newServer() *httptest.Server {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("X-Header", r.Method)
@@ -48,18 +57,14 @@ func newServer() http.Server {
 		}
 	})
 
-	return http.Server{
-		Addr:    ":8000",
-		Handler: mux,
-	}
+	return httptest.NewServer(mux)
 }
 
 func TestHTTP(t *testing.T) {
 	server := newServer()
-	go server.ListenAndServe()
 	defer server.Close()
 
-	u := "http://localhost:8000"
+	u := server.URL
 	obj := test.Module(t, "http").Call("head", u).Obj
 
 	headers := testHeaders("HEAD")
@@ -95,3 +100,350 @@ func TestHTTP(t *testing.T) {
 	expectResp(t, http.StatusOK, "delete body", headers, obj)
 }
 
+func TestHTTPRetry(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := attempts.Add(1)
+		if strings.HasSuffix(r.URL.Path, "/down") {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		if strings.HasSuffix(r.URL.Path, "/later") {
+			w.Header().Set("Retry-After", "120")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+
+		if strings.HasSuffix(r.URL.Path, "/limited") && n == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+
+		if n < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s", r.Method, body)
+	}))
+	defer server.Close()
+
+	compiled := test.RunScript(t, fmt.Sprintf(`
+http := import("http")
+client := http.new_client(%q).retry({max: 3, backoff: "1ms", jitter: "1ms", on_status: [503]})
+resp := client.put("/", "text/plain", "replayed")
+put := [resp.status_code, string(resp.body()), resp.attempts]
+`, server.URL))
+	require.Equal(t, test.Object(test.ARR{200, "PUT replayed", 3}), compiled.Get("put").Object())
+
+	attempts.Store(0)
+	compiled = test.RunScript(t, fmt.Sprintf(`
+http := import("http")
+client := http.new_client(%q).retry({max: 1, backoff: "1ms"})
+resp := client.get("/limited")
+limited := [resp.status_code, resp.attempts]
+resp = client.post("/down", "text/plain", "once")
+post := [resp.status_code, resp.attempts]
+`, server.URL))
+	require.Equal(t, test.Object(test.ARR{503, 2}), compiled.Get("limited").Object())
+	require.Equal(t, test.Object(test.ARR{503, 1}), compiled.Get("post").Object())
+
+	compiled = test.RunScript(t, fmt.Sprintf(`
+http := import("http")
+client := http.new_client(%q).retry({max: 70, backoff: "1ms", max_delay: "2ms", on_status: [503]})
+down := client.get("/down").attempts
+resp := http.new_client(%q).retry({max_delay: "2ms"}).get("/later")
+later := [resp.status_code, resp.attempts]
+`, server.URL, server.URL))
+	require.Equal(t, test.Object(71), compiled.Get("down").Object())
+	require.Equal(t, test.Object(test.ARR{429, 1}), compiled.Get("later").Object())
+}
+
+func TestHTTPLimits(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+
+		for {
+			current := maxInFlight.Load()
+			if n <= current || maxInFlight.CompareAndSwap(current, n) {
+				break
+			}
+		}
+
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	start := time.Now()
+	compiled := test.RunScript(t, fmt.Sprintf(`
+http := import("http")
+client := http.new_client(%q).rate_limit(20)
+clone := client.clone()
+for i := 0; i < 3; i++ {
+	client.get("/")
+	clone.get("/")
+}
+`, server.URL))
+	elapsed := time.Since(start)
+	require.True(t, elapsed >= 200*time.Millisecond, "requests weren't rate limited: %s", elapsed)
+
+	compiled = test.RunScript(t, fmt.Sprintf(`
+http := import("http")
+client := http.new_client(%q).max_concurrency(2)
+`, server.URL))
+
+	client := compiled.Get("client").Object().(*tengohttp.HTTPClient).Clone()
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := client.Value.Get(server.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int32(2), maxInFlight.Load())
+
+	compiled = test.RunScript(t, fmt.Sprintf(`
+http := import("http")
+client := http.new_client(%q).max_concurrency(1)
+`, server.URL))
+
+	client = compiled.Get("client").Object().(*tengohttp.HTTPClient).Clone()
+	held, err := client.Value.Get(server.URL)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	body := &closeTracker{Reader: strings.NewReader("body")}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, server.URL, body)
+	require.NoError(t, err)
+
+	_, err = client.Value.Do(req)
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+	require.True(t, body.closed.Load())
+
+	require.NoError(t, held.Body.Close())
+	resp, err := client.Value.Get(server.URL)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+}
+
+// closeTracker is a request body recording whether it was closed
+type closeTracker struct {
+	io.Reader
+	closed atomic.Bool
+}
+
+func (c *closeTracker) Close() error {
+	c.closed.Store(true)
+	return nil
+}
+
+func TestHTTPSession(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "s3cr3t", Path: "/", MaxAge: 3600})
+			http.SetCookie(w, &http.Cookie{Name: "expired", Value: "old", Path: "/", MaxAge: -1})
+		default:
+			cookie, err := r.Cookie("session")
+			if err != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprintf(w, "%s %s %s", cookie.Value, r.Header.Get("X-Api-Key"), r.UserAgent())
+		}
+	}))
+	defer server.Close()
+
+	sessionFile := filepath.Join(t.TempDir(), "session.json")
+
+	compiled := test.RunScript(t, fmt.Sprintf(`
+http := import("http")
+client := http.new_client(%q).cookie_jar().user_agent("tester")
+client.header.set("X-Api-Key", "key")
+before := client.get("/profile").status_code
+client.get("/login")
+cookies := client.cookies("/profile")
+client.set_cookie("/", "theme", "dark")
+err := client.save_session(%q)
+`, server.URL, sessionFile))
+	require.Equal(t, test.Object(401), compiled.Get("before").Object())
+	require.Equal(t, test.Object(test.IARR{test.IMAP{"name": "session", "value": "s3cr3t"}}), compiled.Get("cookies").Object())
+	require.True(t, compiled.Get("err").IsUndefined())
+
+	compiled = test.RunScript(t, fmt.Sprintf(`
+http := import("http")
+client := http.new_client(%q).load_session(%q)
+profile := string(client.get("/profile").body())
+cookies := len(client.cookies("/"))
+`, server.URL, sessionFile))
+	require.Equal(t, test.Object("s3cr3t key tester"), compiled.Get("profile").Object())
+	require.Equal(t, test.Object(2), compiled.Get("cookies").Object())
+}
+
+func TestHTTPForms(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && attempts.Add(1) == 1 {
+			io.Copy(io.Discard, r.Body)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		err := r.ParseMultipartForm(1 << 20)
+		if err != nil && err != http.ErrNotMultipart {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		mediaType, _, _ := strings.Cut(r.Header.Get("Content-Type"), ";")
+		fmt.Fprintf(w, "%s %d %s %v", mediaType, r.ContentLength, r.Form.Get("user"), r.Form["role"])
+
+		if r.MultipartForm != nil {
+			for _, header := range r.MultipartForm.File["upload"] {
+				file, _ := header.Open()
+				content, _ := io.ReadAll(file)
+				fmt.Fprintf(w, " %s %s %s", header.Filename, header.Header.Get("Content-Type"), content)
+			}
+		}
+	}))
+	defer server.Close()
+
+	upload := filepath.Join(t.TempDir(), "notes.txt")
+	require.NoError(t, os.WriteFile(upload, []byte("file content"), 0644))
+
+	compiled := test.RunScript(t, fmt.Sprintf(`
+http := import("http")
+client := http.new_client(%q).retry({backoff: "1ms"})
+encoded := http.form({user: "admin", role: ["a", "b"]})
+form := string(client.post("/", "", encoded).body())
+
+body := http.multipart({fields: {user: "admin"}, files: {upload: %q}})
+resp := client.put("/", "", body)
+multipart := [string(resp.body()), resp.attempts]
+
+req := client.new_request("POST", "/")
+req.body = http.form({user: "guest"})
+request := string(client.do(req).body())
+`, server.URL, upload))
+	require.Equal(t, test.Object("application/x-www-form-urlencoded 24 admin [a b]"), compiled.Get("form").Object())
+
+	multipart := compiled.Get("multipart").Array()
+	require.True(t, strings.HasPrefix(multipart[0].(string), "multipart/form-data "), "%v", multipart[0])
+	require.True(t, strings.HasSuffix(multipart[0].(string), " admin [] notes.txt text/plain; charset=utf-8 file content"), "%v", multipart[0])
+	require.Equal(t, int64(2), multipart[1])
+	require.Equal(t, test.Object("application/x-www-form-urlencoded 10 guest []"), compiled.Get("request").Object())
+}
+
+func TestHTTPStreaming(t *testing.T) {
+	content := "first line\nsecond line\r\nthird line"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			body, _ := io.ReadAll(r.Body)
+			fmt.Fprintf(w, "%s %d %s", r.Header.Get("Content-Type"), r.ContentLength, body)
+			return
+		}
+
+		if r.URL.Path == "/truncated" {
+			w.Header().Set("Content-Length", "100")
+			fmt.Fprint(w, "first line\nsecond")
+			return
+		}
+
+		http.ServeContent(w, r, "content.txt", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	saved := filepath.Join(dir, "saved.txt")
+	tooLarge := filepath.Join(dir, "large.txt")
+	downloaded := filepath.Join(dir, "downloaded.txt")
+	upload := filepath.Join(dir, "upload.json")
+	require.NoError(t, os.WriteFile(downloaded, []byte(content[:15]), 0644))
+	require.NoError(t, os.WriteFile(upload, []byte(`{"key": "value"}`), 0644))
+	longer := filepath.Join(dir, "longer.txt")
+	require.NoError(t, os.WriteFile(longer, []byte(content+"extra"), 0644))
+
+	compiled := test.RunScript(t, fmt.Sprintf(`
+http := import("http")
+client := http.new_client(%q)
+written := client.get("/").save(%q)
+err := client.get("/").save(%q, 10)
+
+lines := []
+for i, line in client.get("/").lines() {
+	lines = append(lines, [i, line])
+}
+
+resumed := client.download("/", %q, {resume: true})
+complete := client.download("/", %q, {resume: true})
+uploaded := string(client.put("/", "", http.file(%q)).body())
+mismatched := client.download("/", %q, {resume: true})
+
+truncated := client.get("/truncated").lines()
+partial := []
+for line in truncated {
+	partial = append(partial, line)
+}
+complete_lines := client.get("/").lines()
+for line in complete_lines {}
+for line in complete_lines {}
+read_err := [is_error(truncated.err), is_undefined(complete_lines.err)]
+`, server.URL, saved, tooLarge, downloaded, downloaded, upload, longer))
+	require.Equal(t, test.Object(len(content)), compiled.Get("written").Object())
+	require.True(t, strings.Contains(compiled.Get("err").String(), "response body exceeds the max size of 10 bytes"))
+	require.Equal(t, test.Object(test.ARR{
+		test.ARR{0, "first line"},
+		test.ARR{1, "second line"},
+		test.ARR{2, "third line"},
+	}), compiled.Get("lines").Object())
+	require.Equal(t, test.Object(test.IMAP{"written": len(content) - 15, "resumed": true}), compiled.Get("resumed").Object())
+	require.Equal(t, test.Object(test.IMAP{"written": 0, "resumed": true}), compiled.Get("complete").Object())
+	require.Equal(t, test.Object(`application/json 16 {"key": "value"}`), compiled.Get("uploaded").Object())
+	require.True(t, strings.Contains(compiled.Get("mismatched").String(), fmt.Sprintf("file has %d bytes but the content has %d bytes", len(content)+5, len(content))))
+	require.Equal(t, test.Object(test.ARR{"first line", "second"}), compiled.Get("partial").Object())
+	require.Equal(t, test.Object(test.ARR{true, true}), compiled.Get("read_err").Object())
+
+	savedContent, err := os.ReadFile(saved)
+	require.NoError(t, err)
+	require.Equal(t, content, string(savedContent))
+
+	downloadedContent, err := os.ReadFile(downloaded)
+	require.NoError(t, err)
+	require.Equal(t, content, string(downloadedContent))
+
+	_, err = os.Stat(tooLarge)
+	require.True(t, os.IsNotExist(err))
+
+	// The file is only opened once the request is sent, so the replaced file is uploaded
+	lazy := filepath.Join(dir, "lazy.txt")
+	require.NoError(t, os.WriteFile(lazy, []byte("old contents"), 0644))
+
+	body, err := tengohttp.NewFileBody(lazy)
+	require.NoError(t, err)
+	req, err := http.NewRequest(http.MethodPut, server.URL, nil)
+	require.NoError(t, err)
+	require.NoError(t, body.Apply(req, true))
+
+	replacement := filepath.Join(dir, "replacement.txt")
+	require.NoError(t, os.WriteFile(replacement, []byte("new contents"), 0644))
+	require.NoError(t, os.Rename(replacement, lazy))
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	uploaded, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "text/plain; charset=utf-8 12 new contents", string(uploaded))
+}
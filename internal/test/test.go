@@ -130,8 +130,10 @@ func (c CallRes) ExpectTengoError() {
 	require.IsType(c.t, &tengo.Error{}, c.Obj)
 }
 
-func Module(t *testing.T, moduleName string) CallRes {
-	mod := tengomod.GetModuleMap(tengomod.WithModules(moduleName)).GetBuiltinModule(moduleName)
+func Module(t *testing.T, moduleName string, opts ...tengomod.ModuleOption) CallRes {
+	opts = append(opts, tengomod.WithModules(moduleName))
+
+	mod := tengomod.GetModuleMap(opts...).GetBuiltinModule(moduleName)
 	if mod == nil {
 		return CallRes{t: t, Err: fmt.Errorf("module not found: %s", moduleName)}
 	}
@@ -139,6 +141,25 @@ func Module(t *testing.T, moduleName string) CallRes {
 	return CallRes{t: t, Obj: mod}
 }
 
+// RunScript compiles and runs the script with the tengomod modules setup to run compiled functions
+func RunScript(t *testing.T, input string, opts ...tengomod.ModuleOption) *tengo.Compiled {
+	var compiled *tengo.Compiled
+	opts = append(opts, tengomod.WithCompiledFunc(func() *tengo.Compiled {
+		return compiled
+	}))
+
+	s := tengo.NewScript([]byte(input))
+	s.SetImports(tengomod.GetModuleMap(opts...))
+
+	compiled, err := s.Compile()
+	require.NoError(t, err)
+
+	err = compiled.Run()
+	require.NoError(t, err)
+
+	return compiled
+}
+
 func Object(v interface{}) tengo.Object {
 	if v == nil {
 		return nil
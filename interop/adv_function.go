@@ -1,6 +1,7 @@
 package interop
 
 import (
+	"fmt"
 	"net/url"
 	"reflect"
 	"regexp"
@@ -101,6 +102,47 @@ var (
 
 type TypeValidator func(obj tengo.Object, name string) (interface{}, error)
 
+// MapType validates the values of a map using the args, converting it into an ArgMap.
+// Only the keys that exist in the map are set in the ArgMap.
+func MapType(args ...AdvArg) TypeValidator {
+	return func(obj tengo.Object, name string) (interface{}, error) {
+		var objMap map[string]tengo.Object
+		switch o := obj.(type) {
+		case *tengo.Map:
+			objMap = o.Value
+		case *tengo.ImmutableMap:
+			objMap = o.Value
+		default:
+			return nil, tengo.ErrInvalidArgumentType{
+				Name:     name,
+				Expected: "map(compatible)",
+				Found:    obj.TypeName(),
+			}
+		}
+
+		argMap := make(ArgMap)
+		for _, arg := range args {
+			valueObj, ok := objMap[arg.Name]
+			if !ok || valueObj == tengo.UndefinedValue {
+				continue
+			}
+
+			value, err := arg.Type(valueObj, fmt.Sprintf("%s.%s", name, arg.Name))
+			if err != nil {
+				return nil, err
+			}
+
+			if errObj, ok := value.(*tengo.Error); ok {
+				return errObj, nil
+			}
+
+			argMap[arg.Name] = value
+		}
+
+		return argMap, nil
+	}
+}
+
 func CustomType(t interface{}) TypeValidator {
 	return func(obj tengo.Object, name string) (interface{}, error) {
 		expectedType := reflect.TypeOf(t)
@@ -251,6 +293,13 @@ func ObjectArg(name string) AdvArg {
 	}
 }
 
+func MapArg(name string, args ...AdvArg) AdvArg {
+	return AdvArg{
+		Name: name,
+		Type: MapType(args...),
+	}
+}
+
 func UnionArg(name string, types ...TypeValidator) AdvArg {
 	return AdvArg{
 		Name: name,
@@ -446,6 +495,16 @@ func (m ArgMap) GetByteSlice(name string) ([]byte, bool) {
 	return conv, ok
 }
 
+func (m ArgMap) GetArgMap(name string) (ArgMap, bool) {
+	val, ok := m[name]
+	if !ok {
+		return make(ArgMap), ok
+	}
+
+	conv, ok := val.(ArgMap)
+	return conv, ok
+}
+
 func (m ArgMap) Get(name string) (interface{}, bool) {
 	val, ok := m[name]
 	return val, ok
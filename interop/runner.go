@@ -3,10 +3,18 @@ package interop
 import (
 	"context"
 	"errors"
+	"sync"
 
 	"github.com/analog-substance/tengo/v2"
 )
 
+// ErrNoCompiled is returned when a module isn't setup to run compiled functions from Go code
+var ErrNoCompiled error = errors.New("module not setup to run compiled functions from Go code")
+
+// CompiledFuncRunner runs a compiled function of the script on a new VM sharing the script's globals.
+// Since the globals aren't synchronized, Run must only be called while the script's VM is blocked in
+// the Go function that was called by the script, and never by two goroutines at the same time. Calls
+// made by work that keeps running after that function returns must be queued with a CallbackQueue.
 type CompiledFuncRunner struct {
 	ctx      context.Context
 	compiled *tengo.Compiled
@@ -21,6 +29,16 @@ func NewCompiledFuncRunner(fn *tengo.CompiledFunction, compiled *tengo.Compiled,
 	}
 }
 
+// NewModuleFuncRunner creates a runner for the compiled function using the module's getCompiled function,
+// returning ErrNoCompiled if the module wasn't given one
+func NewModuleFuncRunner(fn *tengo.CompiledFunction, getCompiled func() *tengo.Compiled, ctx context.Context) (CompiledFuncRunner, error) {
+	if getCompiled == nil {
+		return CompiledFuncRunner{}, ErrNoCompiled
+	}
+
+	return NewCompiledFuncRunner(fn, getCompiled(), ctx), nil
+}
+
 func (r *CompiledFuncRunner) Run(args ...tengo.Object) (tengo.Object, error) {
 	vm := tengo.NewVM(r.compiled.Bytecode(), r.compiled.Globals(), -1)
 	ch := make(chan tengo.Object, 1)
@@ -55,3 +73,57 @@ func (r *CompiledFuncRunner) Run(args ...tengo.Object) (tengo.Object, error) {
 
 	return obj, nil
 }
+
+// CallbackQueue queues the calls of a compiled function made from background goroutines, so they are
+// run on the script's goroutine the next time it calls into Go code that flushes the queue
+type CallbackQueue struct {
+	runner CompiledFuncRunner
+
+	mutex sync.Mutex
+	calls [][]tengo.Object
+	err   error
+}
+
+func NewCallbackQueue(runner CompiledFuncRunner) *CallbackQueue {
+	return &CallbackQueue{
+		runner: runner,
+	}
+}
+
+// Push queues a call of the function with the arguments. It can be called from any goroutine.
+func (q *CallbackQueue) Push(args ...tengo.Object) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.err == nil {
+		q.calls = append(q.calls, args)
+	}
+}
+
+// Flush runs the calls queued so far in order. Once a call fails, the remaining calls are dropped and
+// its error is returned by every later flush. Like CompiledFuncRunner.Run, it must only be called from
+// the Go function called by the script.
+func (q *CallbackQueue) Flush() error {
+	q.mutex.Lock()
+	calls := q.calls
+	q.calls = nil
+	err := q.err
+	q.mutex.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	for _, args := range calls {
+		_, err = q.runner.Run(args...)
+		if err != nil {
+			q.mutex.Lock()
+			q.err = err
+			q.calls = nil
+			q.mutex.Unlock()
+			return err
+		}
+	}
+
+	return nil
+}
@@ -1,10 +1,66 @@
 package nmap
 
-import "github.com/analog-substance/tengo/v2"
+import (
+	"context"
+	"errors"
+
+	"github.com/analog-substance/tengo/v2"
+	"github.com/analog-substance/tengomod/interop"
+)
+
+var ErrScanCanceled error = errors.New("nmap scan canceled")
+
+type module struct {
+	getCompiled func() *tengo.Compiled
+	ctx         context.Context
+}
+
+func Module(getCompiled func() *tengo.Compiled, ctx context.Context) map[string]tengo.Object {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	m := &module{
+		getCompiled: getCompiled,
+		ctx:         ctx,
+	}
 
-func Module() map[string]tengo.Object {
 	return map[string]tengo.Object{
-		"scanner":           &tengo.UserFunction{Name: "scanner", Value: nmapScanner},
+		"scanner":      &tengo.UserFunction{Name: "scanner", Value: m.nmapScanner},
+		"err_canceled": interop.GoErrToTErr(ErrScanCanceled),
+		"parse_file": &interop.AdvFunction{
+			Name:    "parse_file",
+			NumArgs: interop.MinArgs(1),
+			Args:    []interop.AdvArg{interop.StrSliceArg("paths", true)},
+			Value:   tengoParseFile,
+		},
+		"parse": &interop.AdvFunction{
+			Name:    "parse",
+			NumArgs: interop.ExactArgs(1),
+			Args:    []interop.AdvArg{interop.StrArg("xml")},
+			Value:   tengoParse,
+		},
+		"merge": &tengo.UserFunction{Name: "merge", Value: tengoMerge},
+		"scan_batched": &interop.AdvFunction{
+			Name:    "scan_batched",
+			NumArgs: interop.ArgRange(2, 3),
+			Args: []interop.AdvArg{
+				interop.CustomArg("scanner", &NmapScanner{}),
+				interop.StrSliceArg("targets", false),
+				interop.MapArg("options",
+					interop.IntArg("chunk_size"),
+					interop.IntArg("concurrency"),
+					interop.StrArg("output_dir"),
+				),
+			},
+			Value: tengoScanBatched,
+		},
+		"diff": &interop.AdvFunction{
+			Name:    "diff",
+			NumArgs: interop.ExactArgs(2),
+			Args:    []interop.AdvArg{interop.CustomArg("run_a", &NmapRun{}), interop.CustomArg("run_b", &NmapRun{})},
+			Value:   tengoDiff,
+		},
 		"timing_slowest":    &tengo.Int{Value: 0},
 		"timing_sneaky":     &tengo.Int{Value: 1},
 		"timing_polite":     &tengo.Int{Value: 2},
@@ -16,8 +72,8 @@ func Module() map[string]tengo.Object {
 
 // nmapScanner creates a new NmapScanner
 // Represents 'nmap.scanner() NmapScanner'
-func nmapScanner(args ...tengo.Object) (tengo.Object, error) {
-	scanner, err := makeNmapScanner()
+func (m *module) nmapScanner(args ...tengo.Object) (tengo.Object, error) {
+	scanner, err := makeNmapScanner(m)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,189 @@
+package nmap
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/analog-substance/nmap/v3"
+	"github.com/analog-substance/tengo/v2"
+	"github.com/analog-substance/tengomod/interop"
+)
+
+const (
+	defaultChunkSize   int = 256
+	defaultConcurrency int = 4
+
+	// CIDR targets with more host bits than this are passed to nmap as is
+	maxExpandedBits int = 20
+)
+
+// expandTargets expands CIDR targets into individual addresses so they can be split into chunks.
+// Other targets, like hostnames and nmap ranges, are kept as is.
+func expandTargets(targets []string) []string {
+	var expanded []string
+	for _, target := range targets {
+		prefix, err := netip.ParsePrefix(target)
+		if err != nil || prefix.Addr().BitLen()-prefix.Bits() > maxExpandedBits {
+			expanded = append(expanded, target)
+			continue
+		}
+
+		for addr := prefix.Masked().Addr(); prefix.Contains(addr); addr = addr.Next() {
+			expanded = append(expanded, addr.String())
+		}
+	}
+
+	return expanded
+}
+
+func chunkTargets(targets []string, size int) [][]string {
+	var chunks [][]string
+	for size < len(targets) {
+		chunks = append(chunks, targets[:size])
+		targets = targets[size:]
+	}
+
+	if len(targets) > 0 {
+		chunks = append(chunks, targets)
+	}
+	return chunks
+}
+
+// batchChunk is a chunk of targets scanned by a single nmap process
+type batchChunk struct {
+	targets     []string
+	xmlPath     string
+	targetsPath string
+}
+
+// completed returns the run of the chunk if it was already completed with the same targets
+func (c batchChunk) completed() (*nmap.Run, bool) {
+	content, err := os.ReadFile(c.targetsPath)
+	if err != nil || string(content) != strings.Join(c.targets, "\n") {
+		return nil, false
+	}
+
+	run, truncated, err := ParseFile(c.xmlPath)
+	if err != nil || truncated {
+		return nil, false
+	}
+
+	return run, true
+}
+
+func (c batchChunk) scan(ctx context.Context, s *NmapScanner) (*nmap.Run, error) {
+	if run, ok := c.completed(); ok {
+		return run, nil
+	}
+
+	err := os.WriteFile(c.targetsPath, []byte(strings.Join(c.targets, "\n")), 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	// The targets and output files of the scanner are replaced by the chunk's
+	scanner, err := s.cloneScanOptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner.AddOptions(nmap.WithTargets(c.targets...))
+
+	return runScanner(scanner, c.xmlPath, nil)
+}
+
+// ScanBatched splits the targets into chunks, scanning them concurrently with clones of the scanner.
+// The targets and output files set on the scanner aren't used by the clones. The XML of each chunk is
+// written to the output directory and chunks that were already completed are skipped. The runs of all
+// chunks are merged into a single run.
+func (s *NmapScanner) ScanBatched(targets []string, chunkSize int, concurrency int, outputDir string) (*nmap.Run, error) {
+	err := os.MkdirAll(outputDir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	var chunks []batchChunk
+	for i, targets := range chunkTargets(expandTargets(targets), chunkSize) {
+		chunks = append(chunks, batchChunk{
+			targets:     targets,
+			xmlPath:     filepath.Join(outputDir, fmt.Sprintf("chunk-%05d.xml", i)),
+			targetsPath: filepath.Join(outputDir, fmt.Sprintf("chunk-%05d.targets", i)),
+		})
+	}
+
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("no targets to scan")
+	}
+
+	runs := make([]*nmap.Run, len(chunks))
+	errs := make([]error, len(chunks))
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				runs[i], errs[i] = chunks[i].scan(s.module.ctx, s)
+			}
+		}()
+	}
+
+	for i := range chunks {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("chunk %d: %v", i, err)
+		}
+	}
+
+	return Merge(runs...)
+}
+
+// tengoScanBatched scans the targets in chunks using clones of the scanner
+// Represents 'nmap.scan_batched(scanner NmapScanner, targets []string, options {chunk_size: int, concurrency: int, output_dir: string}?) NmapRun|error'
+func tengoScanBatched(args interop.ArgMap) (tengo.Object, error) {
+	obj, _ := args.GetObject("scanner")
+	targets, _ := args.GetStringSlice("targets")
+	options, _ := args.GetArgMap("options")
+
+	scanner := obj.(*NmapScanner)
+
+	chunkSize, ok := options.GetInt("chunk_size")
+	if !ok || chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+
+	concurrency, ok := options.GetInt("concurrency")
+	if !ok || concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+
+	outputDir, ok := options.GetString("output_dir")
+	if !ok {
+		tempDir, err := os.MkdirTemp("", "nmap-batch-")
+		if err != nil {
+			return interop.GoErrToTErr(err), nil
+		}
+		defer os.RemoveAll(tempDir)
+
+		outputDir = tempDir
+	}
+
+	run, err := scanner.ScanBatched(targets, chunkSize, concurrency, outputDir)
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+
+	return makeNmapRun(run), nil
+}
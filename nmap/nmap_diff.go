@@ -0,0 +1,369 @@
+package nmap
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/analog-substance/nmap/v3"
+	"github.com/analog-substance/tengo/v2"
+	"github.com/analog-substance/tengomod/interop"
+	"github.com/analog-substance/tengomod/types"
+)
+
+// PortChange is a port that was opened or closed between two runs
+type PortChange struct {
+	Host     string
+	Port     int
+	Protocol string
+	Service  string
+}
+
+func (c PortChange) String() string {
+	s := fmt.Sprintf("%s %d/%s", c.Host, c.Port, c.Protocol)
+	if c.Service != "" {
+		s += " " + c.Service
+	}
+	return s
+}
+
+// ServiceChange is an open port whose detected service changed between two runs
+type ServiceChange struct {
+	Host     string
+	Port     int
+	Protocol string
+	Before   string
+	After    string
+}
+
+func (c ServiceChange) String() string {
+	return fmt.Sprintf("%s %d/%s: %s -> %s", c.Host, c.Port, c.Protocol, c.Before, c.After)
+}
+
+// RunDiff contains the changes between two runs
+type RunDiff struct {
+	NewHosts       []string
+	RemovedHosts   []string
+	OpenedPorts    []PortChange
+	ClosedPorts    []PortChange
+	ServiceChanges []ServiceChange
+}
+
+// HasChanges returns whether anything changed between the runs
+func (d *RunDiff) HasChanges() bool {
+	return len(d.NewHosts) > 0 || len(d.RemovedHosts) > 0 || len(d.OpenedPorts) > 0 ||
+		len(d.ClosedPorts) > 0 || len(d.ServiceChanges) > 0
+}
+
+// Text renders the changes as plain text
+func (d *RunDiff) Text() string {
+	if !d.HasChanges() {
+		return "No changes\n"
+	}
+
+	var sb strings.Builder
+	writeSection := func(title string, lines []string) {
+		if len(lines) == 0 {
+			return
+		}
+
+		sb.WriteString(title + ":\n")
+		for _, line := range lines {
+			sb.WriteString("  " + line + "\n")
+		}
+	}
+
+	writeSection("New hosts", d.NewHosts)
+	writeSection("Removed hosts", d.RemovedHosts)
+	writeSection("Opened ports", stringers(d.OpenedPorts))
+	writeSection("Closed ports", stringers(d.ClosedPorts))
+	writeSection("Service changes", stringers(d.ServiceChanges))
+
+	return sb.String()
+}
+
+// Markdown renders the changes as markdown
+func (d *RunDiff) Markdown() string {
+	if !d.HasChanges() {
+		return "No changes\n"
+	}
+
+	var sections []string
+	hostSection := func(title string, hosts []string) {
+		if len(hosts) == 0 {
+			return
+		}
+
+		section := fmt.Sprintf("## %s\n\n", title)
+		for _, host := range hosts {
+			section += fmt.Sprintf("- %s\n", host)
+		}
+		sections = append(sections, section)
+	}
+
+	portSection := func(title string, changes []PortChange) {
+		if len(changes) == 0 {
+			return
+		}
+
+		var rows [][]string
+		for _, c := range changes {
+			rows = append(rows, []string{c.Host, fmt.Sprintf("%d/%s", c.Port, c.Protocol), c.Service})
+		}
+		sections = append(sections, fmt.Sprintf("## %s\n\n", title)+markdownTable([]string{"Host", "Port", "Service"}, rows))
+	}
+
+	hostSection("New Hosts", d.NewHosts)
+	hostSection("Removed Hosts", d.RemovedHosts)
+	portSection("Opened Ports", d.OpenedPorts)
+	portSection("Closed Ports", d.ClosedPorts)
+
+	if len(d.ServiceChanges) > 0 {
+		var rows [][]string
+		for _, c := range d.ServiceChanges {
+			rows = append(rows, []string{c.Host, fmt.Sprintf("%d/%s", c.Port, c.Protocol), c.Before, c.After})
+		}
+		sections = append(sections, "## Service Changes\n\n"+markdownTable([]string{"Host", "Port", "Before", "After"}, rows))
+	}
+
+	return strings.Join(sections, "\n")
+}
+
+func stringers[T fmt.Stringer](items []T) []string {
+	var lines []string
+	for _, item := range items {
+		lines = append(lines, item.String())
+	}
+	return lines
+}
+
+// serviceString describes the service by its name, product and version
+func serviceString(service nmap.Service) string {
+	var parts []string
+	for _, part := range []string{service.Name, service.Product, service.Version} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// upHosts returns the addresses of the hosts that are up in the order they appear in the run
+func upHosts(run *nmap.Run) ([]string, map[string]*nmap.Host) {
+	var addrs []string
+	hosts := make(map[string]*nmap.Host)
+	for i := range run.Hosts {
+		host := &run.Hosts[i]
+		addr := hostAddress(host)
+		if addr == "" || host.Status.State == "down" {
+			continue
+		}
+
+		if _, ok := hosts[addr]; !ok {
+			addrs = append(addrs, addr)
+		}
+		hosts[addr] = host
+	}
+
+	return addrs, hosts
+}
+
+// openPorts returns the open ports of the host keyed by port and protocol
+func openPorts(host *nmap.Host) ([]string, map[string]*nmap.Port) {
+	var keys []string
+	ports := make(map[string]*nmap.Port)
+	if host == nil {
+		return keys, ports
+	}
+
+	for i := range host.Ports {
+		port := &host.Ports[i]
+		if port.Status() != nmap.Open {
+			continue
+		}
+
+		key := fmt.Sprintf("%d/%s", port.ID, port.Protocol)
+		if _, ok := ports[key]; !ok {
+			keys = append(keys, key)
+		}
+		ports[key] = port
+	}
+
+	return keys, ports
+}
+
+func portChange(addr string, port *nmap.Port) PortChange {
+	return PortChange{
+		Host:     addr,
+		Port:     int(port.ID),
+		Protocol: port.Protocol,
+		Service:  serviceString(port.Service),
+	}
+}
+
+// Diff compares the hosts and open ports of run a with run b. The ports of new and removed
+// hosts are included in the opened and closed ports.
+func Diff(a *nmap.Run, b *nmap.Run) *RunDiff {
+	diff := &RunDiff{}
+
+	aAddrs, aHosts := upHosts(a)
+	bAddrs, bHosts := upHosts(b)
+
+	for _, addr := range bAddrs {
+		if _, ok := aHosts[addr]; !ok {
+			diff.NewHosts = append(diff.NewHosts, addr)
+		}
+	}
+
+	for _, addr := range aAddrs {
+		if _, ok := bHosts[addr]; !ok {
+			diff.RemovedHosts = append(diff.RemovedHosts, addr)
+		}
+	}
+
+	// Visit every host in either run, keeping the order of the runs
+	addrs := aAddrs
+	for _, addr := range bAddrs {
+		if _, ok := aHosts[addr]; !ok {
+			addrs = append(addrs, addr)
+		}
+	}
+
+	for _, addr := range addrs {
+		aKeys, aPorts := openPorts(aHosts[addr])
+		bKeys, bPorts := openPorts(bHosts[addr])
+
+		for _, key := range bKeys {
+			bPort := bPorts[key]
+
+			aPort, ok := aPorts[key]
+			if !ok {
+				diff.OpenedPorts = append(diff.OpenedPorts, portChange(addr, bPort))
+				continue
+			}
+
+			before := serviceString(aPort.Service)
+			after := serviceString(bPort.Service)
+			if before != after {
+				diff.ServiceChanges = append(diff.ServiceChanges, ServiceChange{
+					Host:     addr,
+					Port:     int(bPort.ID),
+					Protocol: bPort.Protocol,
+					Before:   before,
+					After:    after,
+				})
+			}
+		}
+
+		for _, key := range aKeys {
+			if _, ok := bPorts[key]; !ok {
+				diff.ClosedPorts = append(diff.ClosedPorts, portChange(addr, aPorts[key]))
+			}
+		}
+	}
+
+	return diff
+}
+
+// NmapDiff represents a tengo object wrapper for *RunDiff
+type NmapDiff struct {
+	types.PropObject
+	Value *RunDiff
+}
+
+// TypeName should return the name of the type.
+func (d *NmapDiff) TypeName() string {
+	return "nmap-diff"
+}
+
+// String should return a string representation of the type's value.
+func (d *NmapDiff) String() string {
+	return d.Value.Text()
+}
+
+// IsFalsy should return true if the value of the type should be considered
+// as falsy.
+func (d *NmapDiff) IsFalsy() bool {
+	return !d.Value.HasChanges()
+}
+
+// CanIterate should return whether the Object can be Iterated.
+func (d *NmapDiff) CanIterate() bool {
+	return false
+}
+
+func portChangesToTArray(changes []PortChange) tengo.Object {
+	var values []tengo.Object
+	for _, c := range changes {
+		values = append(values, &tengo.ImmutableMap{
+			Value: map[string]tengo.Object{
+				"host":     interop.GoStrToTStr(c.Host),
+				"port":     interop.GoIntToTInt(c.Port),
+				"protocol": interop.GoStrToTStr(c.Protocol),
+				"service":  interop.GoStrToTStr(c.Service),
+			},
+		})
+	}
+
+	return &tengo.ImmutableArray{Value: values}
+}
+
+func serviceChangesToTArray(changes []ServiceChange) tengo.Object {
+	var values []tengo.Object
+	for _, c := range changes {
+		values = append(values, &tengo.ImmutableMap{
+			Value: map[string]tengo.Object{
+				"host":     interop.GoStrToTStr(c.Host),
+				"port":     interop.GoIntToTInt(c.Port),
+				"protocol": interop.GoStrToTStr(c.Protocol),
+				"before":   interop.GoStrToTStr(c.Before),
+				"after":    interop.GoStrToTStr(c.After),
+			},
+		})
+	}
+
+	return &tengo.ImmutableArray{Value: values}
+}
+
+func makeNmapDiff(diff *RunDiff) *NmapDiff {
+	nmapDiff := &NmapDiff{
+		Value: diff,
+	}
+
+	objectMap := map[string]tengo.Object{
+		"to_text": &tengo.UserFunction{
+			Name: "to_text",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				return interop.GoStrToTStr(diff.Text()), nil
+			},
+		},
+		"to_markdown": &tengo.UserFunction{
+			Name: "to_markdown",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				return interop.GoStrToTStr(diff.Markdown()), nil
+			},
+		},
+	}
+
+	nmapDiff.PropObject = types.PropObject{
+		ObjectMap: objectMap,
+		Properties: map[string]types.Property{
+			"new_hosts":       types.StaticProperty(interop.GoStrSliceToTArray(diff.NewHosts)),
+			"removed_hosts":   types.StaticProperty(interop.GoStrSliceToTArray(diff.RemovedHosts)),
+			"opened_ports":    types.StaticProperty(portChangesToTArray(diff.OpenedPorts)),
+			"closed_ports":    types.StaticProperty(portChangesToTArray(diff.ClosedPorts)),
+			"service_changes": types.StaticProperty(serviceChangesToTArray(diff.ServiceChanges)),
+			"has_changes":     types.StaticProperty(interop.GoBoolToTBool(diff.HasChanges())),
+		},
+	}
+
+	return nmapDiff
+}
+
+// tengoDiff compares two runs
+// Represents 'nmap.diff(run_a NmapRun, run_b NmapRun) NmapDiff'
+func tengoDiff(args interop.ArgMap) (tengo.Object, error) {
+	a, _ := args.GetObject("run_a")
+	b, _ := args.GetObject("run_b")
+
+	return makeNmapDiff(Diff(a.(*NmapRun).Value, b.(*NmapRun).Value)), nil
+}
@@ -0,0 +1,168 @@
+package nmap
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/analog-substance/nmap/v3"
+	"github.com/analog-substance/tengo/v2"
+	"github.com/analog-substance/tengomod/csv"
+	"github.com/analog-substance/tengomod/interop"
+)
+
+// DefaultColumns are the columns exported when no columns are given
+var DefaultColumns []string = []string{"host", "hostname", "port", "proto", "service", "product", "version"}
+
+var columnValues map[string]func(*nmap.Host, *nmap.Port) string = map[string]func(*nmap.Host, *nmap.Port) string{
+	"host": func(h *nmap.Host, _ *nmap.Port) string {
+		return hostAddress(h)
+	},
+	"hostname": func(h *nmap.Host, _ *nmap.Port) string {
+		if len(h.Hostnames) == 0 {
+			return ""
+		}
+		return h.Hostnames[0].Name
+	},
+	"port": func(_ *nmap.Host, p *nmap.Port) string {
+		return strconv.Itoa(int(p.ID))
+	},
+	"proto": func(_ *nmap.Host, p *nmap.Port) string {
+		return p.Protocol
+	},
+	"state": func(_ *nmap.Host, p *nmap.Port) string {
+		return p.State.State
+	},
+	"service": func(_ *nmap.Host, p *nmap.Port) string {
+		return p.Service.Name
+	},
+	"product": func(_ *nmap.Host, p *nmap.Port) string {
+		return p.Service.Product
+	},
+	"version": func(_ *nmap.Host, p *nmap.Port) string {
+		return p.Service.Version
+	},
+	"extra_info": func(_ *nmap.Host, p *nmap.Port) string {
+		return p.Service.ExtraInfo
+	},
+}
+
+// Rows returns a row with the columns for each open port in the run
+func Rows(run *nmap.Run, columns []string) ([][]string, error) {
+	if len(columns) == 0 {
+		columns = DefaultColumns
+	}
+
+	for _, column := range columns {
+		if _, ok := columnValues[column]; !ok {
+			return nil, fmt.Errorf("unknown column: %s", column)
+		}
+	}
+
+	var rows [][]string
+	for i := range run.Hosts {
+		host := &run.Hosts[i]
+		for j := range host.Ports {
+			port := &host.Ports[j]
+			if port.Status() != nmap.Open {
+				continue
+			}
+
+			var row []string
+			for _, column := range columns {
+				row = append(row, columnValues[column](host, port))
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	return rows, nil
+}
+
+func markdownTable(columns []string, rows [][]string) string {
+	escape := func(cells []string) string {
+		var escaped []string
+		for _, cell := range cells {
+			escaped = append(escaped, strings.ReplaceAll(cell, "|", "\\|"))
+		}
+		return "| " + strings.Join(escaped, " | ") + " |\n"
+	}
+
+	var sb strings.Builder
+	sb.WriteString(escape(columns))
+	sb.WriteString("|" + strings.Repeat(" --- |", len(columns)) + "\n")
+	for _, row := range rows {
+		sb.WriteString(escape(row))
+	}
+
+	return sb.String()
+}
+
+// exportColumns returns the columns given to the export function or the default columns
+func exportColumns(args interop.ArgMap) []string {
+	columns, ok := args.GetStringSlice("columns")
+	if !ok || len(columns) == 0 {
+		return DefaultColumns
+	}
+	return columns
+}
+
+// toCSV writes the open ports to the CSV file with a header row
+// Represents 'run.to_csv(path string, columns []string?) error'
+func (r *NmapRun) toCSV(args interop.ArgMap) (tengo.Object, error) {
+	path, _ := args.GetString("path")
+	columns := exportColumns(args)
+
+	rows, err := Rows(r.Value, columns)
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+
+	err = csv.WriteFile(path, append([][]string{columns}, rows...))
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+
+	return nil, nil
+}
+
+// toJSON returns the open ports as a JSON array of objects keyed by column
+// Represents 'run.to_json(columns []string?) string|error'
+func (r *NmapRun) toJSON(args interop.ArgMap) (tengo.Object, error) {
+	columns := exportColumns(args)
+
+	rows, err := Rows(r.Value, columns)
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+
+	objects := []map[string]string{}
+	for _, row := range rows {
+		object := make(map[string]string)
+		for i, column := range columns {
+			object[column] = row[i]
+		}
+		objects = append(objects, object)
+	}
+
+	bytes, err := json.Marshal(objects)
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+
+	return interop.GoStrToTStr(string(bytes)), nil
+}
+
+// toMarkdown returns the open ports as a markdown table
+// Represents 'run.to_markdown(columns []string?) string|error'
+func (r *NmapRun) toMarkdown(args interop.ArgMap) (tengo.Object, error) {
+	columns := exportColumns(args)
+
+	rows, err := Rows(r.Value, columns)
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+
+	return interop.GoStrToTStr(markdownTable(columns, rows)), nil
+}
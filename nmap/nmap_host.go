@@ -0,0 +1,275 @@
+package nmap
+
+import (
+	"fmt"
+
+	"github.com/analog-substance/nmap/v3"
+	"github.com/analog-substance/tengo/v2"
+	"github.com/analog-substance/tengomod/interop"
+	"github.com/analog-substance/tengomod/types"
+)
+
+// NmapHost represents a tengo object wrapper for *nmap.Host
+type NmapHost struct {
+	types.PropObject
+	Value *nmap.Host
+}
+
+// TypeName should return the name of the type.
+func (h *NmapHost) TypeName() string {
+	return "nmap-host"
+}
+
+// String should return a string representation of the type's value.
+func (h *NmapHost) String() string {
+	return fmt.Sprintf("<nmap-host>: %s", hostAddress(h.Value))
+}
+
+// IsFalsy should return true if the value of the type should be considered
+// as falsy.
+func (h *NmapHost) IsFalsy() bool {
+	return h.Value == nil
+}
+
+// CanIterate should return whether the Object can be Iterated.
+func (h *NmapHost) CanIterate() bool {
+	return false
+}
+
+// hostAddress returns the first IP address of the host, falling back to the first address of any type
+func hostAddress(host *nmap.Host) string {
+	for _, addr := range host.Addresses {
+		if addr.AddrType == "ipv4" || addr.AddrType == "ipv6" {
+			return addr.Addr
+		}
+	}
+
+	if len(host.Addresses) > 0 {
+		return host.Addresses[0].Addr
+	}
+	return ""
+}
+
+func makeNmapHost(host *nmap.Host) *NmapHost {
+	nmapHost := &NmapHost{
+		Value: host,
+	}
+
+	var addresses []tengo.Object
+	for _, addr := range host.Addresses {
+		addresses = append(addresses, &tengo.ImmutableMap{
+			Value: map[string]tengo.Object{
+				"addr":   interop.GoStrToTStr(addr.Addr),
+				"type":   interop.GoStrToTStr(addr.AddrType),
+				"vendor": interop.GoStrToTStr(addr.Vendor),
+			},
+		})
+	}
+
+	var hostnames []tengo.Object
+	for _, hostname := range host.Hostnames {
+		hostnames = append(hostnames, &tengo.ImmutableMap{
+			Value: map[string]tengo.Object{
+				"name": interop.GoStrToTStr(hostname.Name),
+				"type": interop.GoStrToTStr(hostname.Type),
+			},
+		})
+	}
+
+	var ports []tengo.Object
+	for i := range host.Ports {
+		ports = append(ports, makeNmapPort(&host.Ports[i]))
+	}
+
+	nmapHost.PropObject = types.PropObject{
+		ObjectMap: map[string]tengo.Object{
+			"script": scriptLookupFunc(host.HostScripts),
+		},
+		Properties: map[string]types.Property{
+			"address":   types.StaticProperty(interop.GoStrToTStr(hostAddress(host))),
+			"addresses": types.StaticProperty(&tengo.ImmutableArray{Value: addresses}),
+			"hostnames": types.StaticProperty(&tengo.ImmutableArray{Value: hostnames}),
+			"status": types.StaticProperty(&tengo.ImmutableMap{
+				Value: map[string]tengo.Object{
+					"state":  interop.GoStrToTStr(host.Status.State),
+					"reason": interop.GoStrToTStr(host.Status.Reason),
+				},
+			}),
+			"os_matches": types.StaticProperty(osMatchesToTArray(host.OS.Matches)),
+			"ports":      types.StaticProperty(&tengo.ImmutableArray{Value: ports}),
+			"scripts":    types.StaticProperty(scriptsToTArray(host.HostScripts)),
+		},
+	}
+
+	return nmapHost
+}
+
+// NmapPort represents a tengo object wrapper for *nmap.Port
+type NmapPort struct {
+	types.PropObject
+	Value *nmap.Port
+}
+
+// TypeName should return the name of the type.
+func (p *NmapPort) TypeName() string {
+	return "nmap-port"
+}
+
+// String should return a string representation of the type's value.
+func (p *NmapPort) String() string {
+	return fmt.Sprintf("<nmap-port>: %d/%s", p.Value.ID, p.Value.Protocol)
+}
+
+// IsFalsy should return true if the value of the type should be considered
+// as falsy.
+func (p *NmapPort) IsFalsy() bool {
+	return p.Value == nil
+}
+
+// CanIterate should return whether the Object can be Iterated.
+func (p *NmapPort) CanIterate() bool {
+	return false
+}
+
+func makeNmapPort(port *nmap.Port) *NmapPort {
+	nmapPort := &NmapPort{
+		Value: port,
+	}
+
+	nmapPort.PropObject = types.PropObject{
+		ObjectMap: map[string]tengo.Object{
+			"script": scriptLookupFunc(port.Scripts),
+		},
+		Properties: map[string]types.Property{
+			"id":       types.StaticProperty(interop.GoIntToTInt(int(port.ID))),
+			"protocol": types.StaticProperty(interop.GoStrToTStr(port.Protocol)),
+			"state":    types.StaticProperty(interop.GoStrToTStr(port.State.State)),
+			"reason":   types.StaticProperty(interop.GoStrToTStr(port.State.Reason)),
+			"service": types.StaticProperty(&tengo.ImmutableMap{
+				Value: map[string]tengo.Object{
+					"name":       interop.GoStrToTStr(port.Service.Name),
+					"product":    interop.GoStrToTStr(port.Service.Product),
+					"version":    interop.GoStrToTStr(port.Service.Version),
+					"extra_info": interop.GoStrToTStr(port.Service.ExtraInfo),
+					"tunnel":     interop.GoStrToTStr(port.Service.Tunnel),
+					"method":     interop.GoStrToTStr(port.Service.Method),
+					"confidence": interop.GoIntToTInt(port.Service.Confidence),
+					"cpes":       cpesToTArray(port.Service.CPEs),
+				},
+			}),
+			"scripts": types.StaticProperty(scriptsToTArray(port.Scripts)),
+		},
+	}
+
+	return nmapPort
+}
+
+func cpesToTArray(cpes []nmap.CPE) tengo.Object {
+	var values []tengo.Object
+	for _, cpe := range cpes {
+		values = append(values, interop.GoStrToTStr(string(cpe)))
+	}
+
+	return &tengo.ImmutableArray{Value: values}
+}
+
+// osMatchesToTArray converts the OS matches to an immutable array of immutable maps
+func osMatchesToTArray(matches []nmap.OSMatch) tengo.Object {
+	var values []tengo.Object
+	for _, match := range matches {
+		var classes []tengo.Object
+		for _, class := range match.Classes {
+			classes = append(classes, &tengo.ImmutableMap{
+				Value: map[string]tengo.Object{
+					"vendor":     interop.GoStrToTStr(class.Vendor),
+					"family":     interop.GoStrToTStr(class.Family),
+					"generation": interop.GoStrToTStr(class.OSGeneration),
+					"type":       interop.GoStrToTStr(class.Type),
+					"accuracy":   interop.GoIntToTInt(class.Accuracy),
+					"cpes":       cpesToTArray(class.CPEs),
+				},
+			})
+		}
+
+		values = append(values, &tengo.ImmutableMap{
+			Value: map[string]tengo.Object{
+				"name":     interop.GoStrToTStr(match.Name),
+				"accuracy": interop.GoIntToTInt(match.Accuracy),
+				"classes":  &tengo.ImmutableArray{Value: classes},
+			},
+		})
+	}
+
+	return &tengo.ImmutableArray{Value: values}
+}
+
+// scriptsToTArray converts the NSE script results to an immutable array of immutable maps
+func scriptsToTArray(scripts []nmap.Script) tengo.Object {
+	var values []tengo.Object
+	for _, script := range scripts {
+		values = append(values, scriptToTMap(script))
+	}
+
+	return &tengo.ImmutableArray{Value: values}
+}
+
+func scriptToTMap(script nmap.Script) tengo.Object {
+	return &tengo.ImmutableMap{
+		Value: map[string]tengo.Object{
+			"id":       interop.GoStrToTStr(script.ID),
+			"output":   interop.GoStrToTStr(script.Output),
+			"elements": elementsToTArray(script.Elements),
+			"tables":   tablesToTArray(script.Tables),
+		},
+	}
+}
+
+// scriptLookupFunc creates the function returning the output of the script with the given ID
+// Represents 'script(id string) {id: string, output: string, elements: [], tables: []}|undefined'
+func scriptLookupFunc(scripts []nmap.Script) *interop.AdvFunction {
+	return &interop.AdvFunction{
+		Name:    "script",
+		NumArgs: interop.ExactArgs(1),
+		Args:    []interop.AdvArg{interop.StrArg("id")},
+		Value: func(args interop.ArgMap) (tengo.Object, error) {
+			id, _ := args.GetString("id")
+
+			for _, script := range scripts {
+				if script.ID == id {
+					return scriptToTMap(script), nil
+				}
+			}
+
+			return nil, nil
+		},
+	}
+}
+
+func elementsToTArray(elements []nmap.Element) tengo.Object {
+	var values []tengo.Object
+	for _, elem := range elements {
+		values = append(values, &tengo.ImmutableMap{
+			Value: map[string]tengo.Object{
+				"key":   interop.GoStrToTStr(elem.Key),
+				"value": interop.GoStrToTStr(elem.Value),
+			},
+		})
+	}
+
+	return &tengo.ImmutableArray{Value: values}
+}
+
+func tablesToTArray(tables []nmap.Table) tengo.Object {
+	var values []tengo.Object
+	for _, table := range tables {
+		values = append(values, &tengo.ImmutableMap{
+			Value: map[string]tengo.Object{
+				"key":      interop.GoStrToTStr(table.Key),
+				"elements": elementsToTArray(table.Elements),
+				"tables":   tablesToTArray(table.Tables),
+			},
+		})
+	}
+
+	return &tengo.ImmutableArray{Value: values}
+}
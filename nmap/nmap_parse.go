@@ -0,0 +1,316 @@
+package nmap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/analog-substance/nmap/v3"
+	"github.com/analog-substance/tengo/v2"
+	"github.com/analog-substance/tengomod/interop"
+)
+
+// Parse parses the nmap XML. If the XML was truncated, like from an interrupted scan, the hosts
+// that were fully written are kept and truncated is true.
+func Parse(content []byte) (run *nmap.Run, truncated bool, err error) {
+	run = &nmap.Run{}
+
+	err = nmap.Parse(content, run)
+	if err == nil {
+		return run, false, nil
+	}
+
+	repaired, ok := repairTruncatedXML(content)
+	if !ok {
+		return nil, false, err
+	}
+
+	run = &nmap.Run{}
+	err = nmap.Parse(repaired, run)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return run, true, nil
+}
+
+// ParseFile parses the nmap XML file
+func ParseFile(path string) (*nmap.Run, bool, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return Parse(content)
+}
+
+// repairTruncatedXML cuts the XML after the last complete child of the root element and closes
+// the root element. false is returned if the XML isn't truncated or can't be repaired.
+func repairTruncatedXML(content []byte) ([]byte, bool) {
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+
+	var stack []xml.Name
+	var root xml.Name
+	var safeOffset int64
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			// The XML is complete, so the error isn't because of truncation
+			if len(stack) == 0 {
+				return nil, false
+			}
+			break
+		}
+
+		if err != nil {
+			break
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if len(stack) == 0 {
+				root = t.Name
+			}
+			stack = append(stack, t.Name)
+		case xml.EndElement:
+			if len(stack) == 0 {
+				return nil, false
+			}
+			stack = stack[:len(stack)-1]
+		}
+
+		if len(stack) == 1 {
+			safeOffset = decoder.InputOffset()
+		}
+	}
+
+	if safeOffset == 0 {
+		return nil, false
+	}
+
+	name := root.Local
+	if root.Space != "" {
+		name = root.Space + ":" + name
+	}
+
+	repaired := make([]byte, safeOffset, safeOffset+int64(len(name))+3)
+	copy(repaired, content[:safeOffset])
+	return append(repaired, []byte(fmt.Sprintf("</%s>", name))...), true
+}
+
+// Merge merges the runs into a single run. Hosts with the same address are combined, with the ports
+// from later runs replacing the matching ports from earlier runs.
+func Merge(runs ...*nmap.Run) (*nmap.Run, error) {
+	if len(runs) == 0 {
+		return nil, fmt.Errorf("no runs to merge")
+	}
+
+	merged := &nmap.Run{
+		Args:             runs[0].Args,
+		ProfileName:      runs[0].ProfileName,
+		Scanner:          runs[0].Scanner,
+		StartStr:         runs[0].StartStr,
+		Version:          runs[0].Version,
+		XMLOutputVersion: runs[0].XMLOutputVersion,
+		Debugging:        runs[0].Debugging,
+		ScanInfo:         runs[0].ScanInfo,
+		Start:            runs[0].Start,
+		Verbose:          runs[0].Verbose,
+		Stats:            runs[0].Stats,
+	}
+
+	hostIndexes := make(map[string]int)
+	for i, run := range runs {
+		if i > 0 {
+			mergeStats(merged, run)
+		}
+
+		merged.PreScripts = append(merged.PreScripts, run.PreScripts...)
+		merged.PostScripts = append(merged.PostScripts, run.PostScripts...)
+		merged.Targets = append(merged.Targets, run.Targets...)
+
+		for _, host := range run.Hosts {
+			addr := hostAddress(&host)
+
+			index, ok := hostIndexes[addr]
+			if !ok || addr == "" {
+				hostIndexes[addr] = len(merged.Hosts)
+				merged.Hosts = append(merged.Hosts, host)
+				continue
+			}
+
+			mergeHost(&merged.Hosts[index], host)
+		}
+	}
+
+	updateStats(merged)
+
+	// Round trip through XML so the merged run has raw XML like a parsed run
+	content, err := xml.Marshal(merged)
+	if err != nil {
+		return nil, err
+	}
+
+	run := &nmap.Run{}
+	err = nmap.Parse(append([]byte(xml.Header), content...), run)
+	if err != nil {
+		return nil, err
+	}
+
+	return run, nil
+}
+
+func mergeStats(merged *nmap.Run, run *nmap.Run) {
+	if time.Time(run.Start).Before(time.Time(merged.Start)) {
+		merged.Start = run.Start
+		merged.StartStr = run.StartStr
+	}
+
+	finished := &merged.Stats.Finished
+	if time.Time(run.Stats.Finished.Time).After(time.Time(finished.Time)) {
+		finished.Time = run.Stats.Finished.Time
+		finished.TimeStr = run.Stats.Finished.TimeStr
+	}
+}
+
+// updateStats sets the host counts from the merged hosts, as hosts scanned by more than one run are only
+// counted once, and the elapsed time from the earliest start to the latest finish
+func updateStats(merged *nmap.Run) {
+	hosts := &merged.Stats.Hosts
+	hosts.Up, hosts.Down, hosts.Total = 0, 0, len(merged.Hosts)
+	for _, host := range merged.Hosts {
+		if host.Status.State == "up" {
+			hosts.Up++
+		} else {
+			hosts.Down++
+		}
+	}
+
+	start := time.Time(merged.Start)
+	finish := time.Time(merged.Stats.Finished.Time)
+	if !start.IsZero() && !finish.IsZero() {
+		merged.Stats.Finished.Elapsed = float32(finish.Sub(start).Seconds())
+	}
+}
+
+func mergeHost(dst *nmap.Host, src nmap.Host) {
+	if src.Status.State == "up" {
+		dst.Status = src.Status
+	}
+
+	for _, hostname := range src.Hostnames {
+		found := false
+		for _, h := range dst.Hostnames {
+			if h.Name == hostname.Name {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			dst.Hostnames = append(dst.Hostnames, hostname)
+		}
+	}
+
+	for _, port := range src.Ports {
+		found := false
+		for i, p := range dst.Ports {
+			if p.ID == port.ID && p.Protocol == port.Protocol {
+				dst.Ports[i] = port
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			dst.Ports = append(dst.Ports, port)
+		}
+	}
+
+	dst.HostScripts = append(dst.HostScripts, src.HostScripts...)
+	if len(src.OS.Matches) > 0 {
+		dst.OS = src.OS
+	}
+}
+
+// tengoParseFile parses the nmap XML files, merging them into a single run if multiple files are given
+// Represents 'nmap.parse_file(paths ...string) NmapRun|error'
+func tengoParseFile(args interop.ArgMap) (tengo.Object, error) {
+	paths, _ := args.GetStringSlice("paths")
+
+	var runs []*nmap.Run
+	truncated := false
+	for _, path := range paths {
+		run, t, err := ParseFile(path)
+		if err != nil {
+			return interop.GoErrToTErr(fmt.Errorf("%s: %v", path, err)), nil
+		}
+
+		runs = append(runs, run)
+		truncated = truncated || t
+	}
+
+	if len(runs) == 1 {
+		return makeTruncatedNmapRun(runs[0], truncated), nil
+	}
+
+	run, err := Merge(runs...)
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+
+	return makeTruncatedNmapRun(run, truncated), nil
+}
+
+// tengoParse parses the nmap XML string
+// Represents 'nmap.parse(xml string) NmapRun|error'
+func tengoParse(args interop.ArgMap) (tengo.Object, error) {
+	content, _ := args.GetString("xml")
+
+	run, truncated, err := Parse([]byte(content))
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+
+	return makeTruncatedNmapRun(run, truncated), nil
+}
+
+// tengoMerge merges the runs into a single run
+// Represents 'nmap.merge(runs ...NmapRun) NmapRun|error'
+func tengoMerge(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) == 0 {
+		return nil, tengo.ErrWrongNumArguments
+	}
+
+	var runs []*nmap.Run
+	truncated := false
+	for i, arg := range args {
+		run, ok := arg.(*NmapRun)
+		if !ok {
+			return nil, tengo.ErrInvalidArgumentType{
+				Name:     fmt.Sprintf("runs[%d]", i),
+				Expected: "nmap-run",
+				Found:    arg.TypeName(),
+			}
+		}
+
+		runs = append(runs, run.Value)
+		truncated = truncated || run.truncated
+	}
+
+	run, err := Merge(runs...)
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+
+	return makeTruncatedNmapRun(run, truncated), nil
+}
+
+func makeTruncatedNmapRun(run *nmap.Run, truncated bool) *NmapRun {
+	nmapRun := makeNmapRun(run)
+	nmapRun.truncated = truncated
+	return nmapRun
+}
@@ -0,0 +1,134 @@
+package nmap
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/analog-substance/nmap/v3"
+	"github.com/analog-substance/tengo/v2"
+	"github.com/analog-substance/tengomod/interop"
+)
+
+// openPortsOf calls fn for each open port of each host in the run
+func openPortsOf(run *nmap.Run, fn func(i int, host *nmap.Host, port *nmap.Port)) {
+	for i := range run.Hosts {
+		host := &run.Hosts[i]
+		for j := range host.Ports {
+			port := &host.Ports[j]
+			if port.Status() == nmap.Open {
+				fn(i, host, port)
+			}
+		}
+	}
+}
+
+// webServices maps the names nmap gives web services to their scheme. Services like http-rpc-epmap only
+// share the prefix and aren't web services. Services over SSL are reported with an ssl tunnel instead
+// of an ssl/ prefix.
+var webServices = map[string]string{
+	"http":       "http",
+	"http-alt":   "http",
+	"http-proxy": "http",
+	"https":      "https",
+	"https-alt":  "https",
+}
+
+// WebTarget returns the URL of the port if it is an http or https service
+func WebTarget(host *nmap.Host, port *nmap.Port) (string, bool) {
+	scheme, ok := webServices[port.Service.Name]
+	if !ok {
+		return "", false
+	}
+
+	if port.Service.Tunnel == "ssl" {
+		scheme = "https"
+	}
+
+	// Prefer the hostname the host was scanned by, so virtual hosts work
+	hostname := hostAddress(host)
+	for _, h := range host.Hostnames {
+		if h.Type == "user" {
+			hostname = h.Name
+			break
+		}
+	}
+
+	return fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(hostname, fmt.Sprint(port.ID))), true
+}
+
+// hostsWithPort returns the hosts with the port open
+// Represents 'run.hosts_with_port(port int, protocol string?) []NmapHost'
+func (r *NmapRun) hostsWithPort(args interop.ArgMap) (tengo.Object, error) {
+	portID, _ := args.GetInt("port")
+	protocol, ok := args.GetString("protocol")
+	if !ok {
+		protocol = "tcp"
+	}
+
+	var hosts []tengo.Object
+	added := make(map[int]bool)
+	openPortsOf(r.Value, func(i int, host *nmap.Host, port *nmap.Port) {
+		if int(port.ID) == portID && port.Protocol == protocol && !added[i] {
+			added[i] = true
+			hosts = append(hosts, r.hosts[i])
+		}
+	})
+
+	return &tengo.ImmutableArray{Value: hosts}, nil
+}
+
+// services returns the open ports whose service name matches the regex
+// Represents 'run.services(name_regex string) []{host: string, hostname: string, port: int, proto: string, service: string, product: string, version: string}'
+func (r *NmapRun) services(args interop.ArgMap) (tengo.Object, error) {
+	re, _ := args.GetRegex("name_regex")
+
+	var services []tengo.Object
+	openPortsOf(r.Value, func(_ int, host *nmap.Host, port *nmap.Port) {
+		if !re.MatchString(port.Service.Name) {
+			return
+		}
+
+		service := make(map[string]tengo.Object)
+		for _, column := range DefaultColumns {
+			service[column] = interop.GoStrToTStr(columnValues[column](host, port))
+		}
+		service["port"] = interop.GoIntToTInt(int(port.ID))
+
+		services = append(services, &tengo.ImmutableMap{Value: service})
+	})
+
+	return &tengo.ImmutableArray{Value: services}, nil
+}
+
+// openPortsByHost returns the open port numbers keyed by host address
+// Represents 'run.open_ports_by_host() map[string][]int'
+func (r *NmapRun) openPortsByHost(args ...tengo.Object) (tengo.Object, error) {
+	ports := make(map[string][]int)
+	openPortsOf(r.Value, func(_ int, host *nmap.Host, port *nmap.Port) {
+		addr := hostAddress(host)
+		ports[addr] = append(ports[addr], int(port.ID))
+	})
+
+	byHost := make(map[string]tengo.Object)
+	for addr, p := range ports {
+		byHost[addr] = interop.GoIntSliceToTArray(p)
+	}
+
+	return &tengo.ImmutableMap{Value: byHost}, nil
+}
+
+// webTargets returns the URLs of the http and https services
+// Represents 'run.web_targets() []string'
+func (r *NmapRun) webTargets(args ...tengo.Object) (tengo.Object, error) {
+	var targets []string
+	seen := make(map[string]bool)
+	openPortsOf(r.Value, func(_ int, host *nmap.Host, port *nmap.Port) {
+		target, ok := WebTarget(host, port)
+		if ok && !seen[target] {
+			seen[target] = true
+			targets = append(targets, target)
+		}
+	})
+
+	return interop.GoStrSliceToTArray(targets), nil
+}
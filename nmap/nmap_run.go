@@ -0,0 +1,147 @@
+package nmap
+
+import (
+	"io"
+	"time"
+
+	"github.com/analog-substance/nmap/v3"
+	"github.com/analog-substance/tengo/v2"
+	"github.com/analog-substance/tengomod/interop"
+	"github.com/analog-substance/tengomod/types"
+)
+
+// NmapRun represents a simple tengo object wrapper for *nmap.Run
+type NmapRun struct {
+	types.PropObject
+	Value *nmap.Run
+
+	hosts     []tengo.Object
+	truncated bool
+}
+
+// TypeName should return the name of the type.
+func (s *NmapRun) TypeName() string {
+	return "nmap-run"
+}
+
+// String should return a string representation of the type's value.
+func (r *NmapRun) String() string {
+	bytes, _ := io.ReadAll(r.Value.ToReader())
+	return string(bytes)
+}
+
+// IsFalsy should return true if the value of the type should be considered
+// as falsy.
+func (r *NmapRun) IsFalsy() bool {
+	return r.Value == nil
+}
+
+// CanIterate should return whether the Object can be Iterated.
+func (r *NmapRun) CanIterate() bool {
+	return false
+}
+
+func makeNmapRun(run *nmap.Run) *NmapRun {
+	nmapRun := &NmapRun{
+		Value: run,
+	}
+
+	var ports []int
+	var hosts []tengo.Object
+	for i := range nmapRun.Value.Hosts {
+		host := &nmapRun.Value.Hosts[i]
+		for _, p := range host.Ports {
+			ports = append(ports, int(p.ID))
+		}
+
+		hosts = append(hosts, makeNmapHost(host))
+	}
+	nmapRun.hosts = hosts
+
+	objectMap := map[string]tengo.Object{
+		"to_csv": &interop.AdvFunction{
+			Name:    "to_csv",
+			NumArgs: interop.ArgRange(1, 2),
+			Args:    []interop.AdvArg{interop.StrArg("path"), interop.StrSliceArg("columns", false)},
+			Value:   nmapRun.toCSV,
+		},
+		"to_json": &interop.AdvFunction{
+			Name:    "to_json",
+			NumArgs: interop.MaxArgs(1),
+			Args:    []interop.AdvArg{interop.StrSliceArg("columns", false)},
+			Value:   nmapRun.toJSON,
+		},
+		"to_markdown": &interop.AdvFunction{
+			Name:    "to_markdown",
+			NumArgs: interop.MaxArgs(1),
+			Args:    []interop.AdvArg{interop.StrSliceArg("columns", false)},
+			Value:   nmapRun.toMarkdown,
+		},
+		"hosts_with_port": &interop.AdvFunction{
+			Name:    "hosts_with_port",
+			NumArgs: interop.ArgRange(1, 2),
+			Args:    []interop.AdvArg{interop.IntArg("port"), interop.StrArg("protocol")},
+			Value:   nmapRun.hostsWithPort,
+		},
+		"services": &interop.AdvFunction{
+			Name:    "services",
+			NumArgs: interop.ExactArgs(1),
+			Args:    []interop.AdvArg{interop.RegexArg("name_regex")},
+			Value:   nmapRun.services,
+		},
+		"open_ports_by_host": &tengo.UserFunction{
+			Name:  "open_ports_by_host",
+			Value: nmapRun.openPortsByHost,
+		},
+		"web_targets": &tengo.UserFunction{
+			Name:  "web_targets",
+			Value: nmapRun.webTargets,
+		},
+	}
+
+	nmapRun.PropObject = types.PropObject{
+		ObjectMap: objectMap,
+		Properties: map[string]types.Property{
+			"ports":        types.StaticProperty(interop.GoIntSliceToTArray(ports)),
+			"hosts":        types.StaticProperty(&tengo.ImmutableArray{Value: hosts}),
+			"args":         types.StaticProperty(interop.GoStrToTStr(run.Args)),
+			"version":      types.StaticProperty(interop.GoStrToTStr(run.Version)),
+			"start":        types.StaticProperty(timestampToTTime(run.Start)),
+			"stats":        types.StaticProperty(statsToTMap(run.Stats)),
+			"pre_scripts":  types.StaticProperty(scriptsToTArray(run.PreScripts)),
+			"post_scripts": types.StaticProperty(scriptsToTArray(run.PostScripts)),
+			"truncated": {
+				Get: func() tengo.Object {
+					return interop.GoBoolToTBool(nmapRun.truncated)
+				},
+			},
+		},
+	}
+
+	return nmapRun
+}
+
+// statsToTMap converts the run stats to an immutable map
+func statsToTMap(stats nmap.Stats) tengo.Object {
+	return &tengo.ImmutableMap{
+		Value: map[string]tengo.Object{
+			"elapsed": &tengo.Float{Value: float64(stats.Finished.Elapsed)},
+			"end":     timestampToTTime(stats.Finished.Time),
+			"summary": interop.GoStrToTStr(stats.Finished.Summary),
+			"exit":    interop.GoStrToTStr(stats.Finished.Exit),
+			"up":      interop.GoIntToTInt(stats.Hosts.Up),
+			"down":    interop.GoIntToTInt(stats.Hosts.Down),
+			"total":   interop.GoIntToTInt(stats.Hosts.Total),
+		},
+	}
+}
+
+// timestampToTTime converts the timestamp to a tengo time, returning undefined if the timestamp isn't set
+func timestampToTTime(ts nmap.Timestamp) tengo.Object {
+	t := time.Time(ts)
+	if t.IsZero() || t.Unix() == 0 {
+		return tengo.UndefinedValue
+	}
+
+	return &tengo.Time{Value: t}
+}
@@ -0,0 +1,345 @@
+package nmap
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/analog-substance/nmap/v3"
+	"github.com/analog-substance/tengo/v2"
+	"github.com/analog-substance/tengomod/interop"
+	"github.com/analog-substance/tengomod/types"
+)
+
+var (
+	taskProgressRegex = regexp.MustCompile(`<taskprogress\s`)
+	xmlAttrRegex      = regexp.MustCompile(`(\w+)="([^"]*)"`)
+	timingStatusRegex = regexp.MustCompile(`^(.+?) Timing: About ([\d.]+)% done(?:; ETC: \S+ \((\d+):(\d+):(\d+) remaining\))?`)
+)
+
+// Progress is the progress of the current nmap task
+type Progress struct {
+	Task      string
+	Percent   float64
+	Remaining time.Duration
+	ETC       time.Time
+}
+
+func (p Progress) toTengo() tengo.Object {
+	etc := tengo.UndefinedValue
+	if !p.ETC.IsZero() {
+		etc = &tengo.Time{Value: p.ETC}
+	}
+
+	return &tengo.ImmutableMap{
+		Value: map[string]tengo.Object{
+			"task":      interop.GoStrToTStr(p.Task),
+			"percent":   &tengo.Float{Value: p.Percent},
+			"remaining": interop.GoStrToTStr(p.Remaining.String()),
+			"etc":       etc,
+		},
+	}
+}
+
+// parseProgress parses the progress from a line of nmap's --stats-every output. Both the taskprogress
+// elements of the XML output and the timing lines of the normal output are supported.
+func parseProgress(line string) (Progress, bool) {
+	if match := timingStatusRegex.FindStringSubmatch(line); match != nil {
+		progress := Progress{Task: match[1]}
+		progress.Percent, _ = strconv.ParseFloat(match[2], 64)
+
+		if match[3] != "" {
+			hours, _ := strconv.Atoi(match[3])
+			minutes, _ := strconv.Atoi(match[4])
+			seconds, _ := strconv.Atoi(match[5])
+
+			progress.Remaining = time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute +
+				time.Duration(seconds)*time.Second
+			progress.ETC = time.Now().Add(progress.Remaining).Truncate(time.Second)
+		}
+
+		return progress, true
+	}
+
+	start := taskProgressRegex.FindStringIndex(line)
+	if start == nil {
+		return Progress{}, false
+	}
+
+	var progress Progress
+	for _, attr := range xmlAttrRegex.FindAllStringSubmatch(line[start[1]:], -1) {
+		switch attr[1] {
+		case "task":
+			progress.Task = attr[2]
+		case "percent":
+			progress.Percent, _ = strconv.ParseFloat(attr[2], 64)
+		case "remaining":
+			seconds, _ := strconv.Atoi(attr[2])
+			progress.Remaining = time.Duration(seconds) * time.Second
+		case "etc":
+			etc, err := strconv.ParseInt(attr[2], 10, 64)
+			if err == nil {
+				progress.ETC = time.Unix(etc, 0)
+			}
+		}
+	}
+
+	return progress, true
+}
+
+// progressWriter parses the progress from the output written to it, passing the output through to w
+type progressWriter struct {
+	io.Writer
+	pw   *io.PipeWriter
+	done chan struct{}
+}
+
+func newProgressWriter(w io.Writer, onProgress func(Progress)) *progressWriter {
+	pr, pw := io.Pipe()
+
+	writer := &progressWriter{
+		Writer: io.MultiWriter(w, pw),
+		pw:     pw,
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		defer close(writer.done)
+
+		scanner := bufio.NewScanner(pr)
+		scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+		for scanner.Scan() {
+			if progress, ok := parseProgress(scanner.Text()); ok {
+				onProgress(progress)
+			}
+		}
+
+		// Make sure nmap never blocks writing to stdout
+		io.Copy(io.Discard, pr)
+	}()
+
+	return writer
+}
+
+// Close waits for the remaining output to be parsed
+func (w *progressWriter) Close() error {
+	w.pw.Close()
+	<-w.done
+	return nil
+}
+
+// NmapScan is a handle to an nmap scan running in the background
+type NmapScan struct {
+	types.PropObject
+
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mutex     sync.Mutex
+	run       *nmap.Run
+	err       error
+	progress  *Progress
+	callbacks *interop.CallbackQueue
+}
+
+// TypeName should return the name of the type.
+func (s *NmapScan) TypeName() string {
+	return "nmap-scan"
+}
+
+// String should return a string representation of the type's value.
+func (s *NmapScan) String() string {
+	if s.isRunning() {
+		return "<nmap-scan>: running"
+	}
+	return "<nmap-scan>: done"
+}
+
+// IsFalsy should return true if the value of the type should be considered
+// as falsy.
+func (s *NmapScan) IsFalsy() bool {
+	return false
+}
+
+// CanIterate should return whether the Object can be Iterated.
+func (s *NmapScan) CanIterate() bool {
+	return false
+}
+
+func (s *NmapScan) isRunning() bool {
+	select {
+	case <-s.done:
+		return false
+	default:
+		return true
+	}
+}
+
+func (s *NmapScan) setProgress(progress Progress) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.progress = &progress
+}
+
+// flushCallbacks runs the progress callback with the progress reported so far
+func (s *NmapScan) flushCallbacks() error {
+	if s.callbacks == nil {
+		return nil
+	}
+
+	return s.callbacks.Flush()
+}
+
+// Wait blocks until the scan finishes and returns its result. The queued progress callbacks are run
+// before returning, so Wait must be called from the script's goroutine.
+func (s *NmapScan) Wait() (*nmap.Run, error) {
+	<-s.done
+
+	s.mutex.Lock()
+	run, err := s.run, s.err
+	s.mutex.Unlock()
+
+	callbackErr := s.flushCallbacks()
+	if err == nil && callbackErr != nil {
+		run, err = nil, callbackErr
+	}
+
+	return run, err
+}
+
+// wait blocks until the scan finishes
+// Represents 'scan.wait() NmapRun|error'
+func (s *NmapScan) wait(args ...tengo.Object) (tengo.Object, error) {
+	run, err := s.Wait()
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+
+	return makeNmapRun(run), nil
+}
+
+// getProgress returns the latest progress reported by nmap, running the progress callback with the
+// progress reported since it last ran
+// Represents 'scan.progress() {task: string, percent: float, remaining: string, etc: time}|error|undefined'
+func (s *NmapScan) getProgress(args ...tengo.Object) (tengo.Object, error) {
+	err := s.flushCallbacks()
+	if err != nil {
+		return interop.GoErrToTErr(err), nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.progress == nil {
+		return nil, nil
+	}
+
+	return s.progress.toTengo(), nil
+}
+
+// runAsync runs the scanner in the background. The progress is reported every stats_every duration,
+// which defaults to 5s. Since the script keeps running, the progress callback is only run when the
+// script calls scan.progress(), scan.is_running() or scan.wait().
+// Represents 'scanner.run_async(options {on_progress: func(progress), stats_every: string}?) NmapScan|error'
+func (s *NmapScanner) runAsync(args interop.ArgMap) (tengo.Object, error) {
+	options, _ := args.GetArgMap("options")
+
+	statsEvery, ok := options.GetString("stats_every")
+	if !ok {
+		statsEvery = "5s"
+	}
+
+	var callbacks *interop.CallbackQueue
+	if fn, ok := options.GetCompiledFunc("on_progress"); ok {
+		runner, err := interop.NewModuleFuncRunner(fn, s.module.getCompiled, s.module.ctx)
+		if err != nil {
+			return interop.GoErrToTErr(err), nil
+		}
+		callbacks = interop.NewCallbackQueue(runner)
+	}
+
+	ctx, cancel := context.WithCancel(s.module.ctx)
+
+	scanner, err := s.clone(ctx)
+	if err != nil {
+		cancel()
+		return interop.GoErrToTErr(err), nil
+	}
+	scanner.AddOptions(nmap.WithCustomArguments("--stats-every", statsEvery))
+
+	scan := &NmapScan{
+		cancel:    cancel,
+		done:      make(chan struct{}),
+		callbacks: callbacks,
+	}
+
+	writer := newProgressWriter(os.Stdout, func(progress Progress) {
+		scan.setProgress(progress)
+
+		if callbacks != nil {
+			callbacks.Push(progress.toTengo())
+		}
+	})
+
+	go func() {
+		defer cancel()
+
+		run, err := runScanner(scanner, s.toFile, writer)
+		writer.Close()
+
+		if err != nil && ctx.Err() != nil {
+			err = ErrScanCanceled
+		}
+
+		scan.mutex.Lock()
+		scan.run = run
+		scan.err = err
+		scan.mutex.Unlock()
+
+		close(scan.done)
+	}()
+
+	objectMap := map[string]tengo.Object{
+		"wait": &tengo.UserFunction{
+			Name:  "wait",
+			Value: scan.wait,
+		},
+		"cancel": &tengo.UserFunction{
+			Name: "cancel",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				scan.cancel()
+				return nil, nil
+			},
+		},
+		"progress": &tengo.UserFunction{
+			Name:  "progress",
+			Value: scan.getProgress,
+		},
+		"is_running": &tengo.UserFunction{
+			Name: "is_running",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				running := scan.isRunning()
+
+				err := scan.flushCallbacks()
+				if err != nil {
+					return interop.GoErrToTErr(err), nil
+				}
+
+				return interop.GoBoolToTBool(running), nil
+			},
+		},
+	}
+
+	scan.PropObject = types.PropObject{
+		ObjectMap:  objectMap,
+		Properties: make(map[string]types.Property),
+	}
+
+	return scan, nil
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
 	"strings"
 	"time"
 
@@ -15,10 +16,91 @@ import (
 	"github.com/analog-substance/tengomod/types"
 )
 
+// optionKind tells which options are left out when the scanner is cloned to scan a chunk of targets
+type optionKind int
+
+const (
+	scanOption optionKind = iota
+	targetOption
+	outputOption
+)
+
+type scannerOption struct {
+	option nmap.Option
+	kind   optionKind
+}
+
 // NmapScanner is the tengo wrapper object for nmap.Scanner
 type NmapScanner struct {
 	types.PropObject
 	Value *nmap.Scanner
+
+	module  *module
+	options []scannerOption
+	toFile  string
+}
+
+// addOptions adds the options to the scanner, keeping track of them so the scanner can be cloned
+func (s *NmapScanner) addOptions(options ...nmap.Option) {
+	s.addOptionsOfKind(scanOption, options...)
+}
+
+func (s *NmapScanner) addOptionsOfKind(kind optionKind, options ...nmap.Option) {
+	for _, option := range options {
+		s.options = append(s.options, scannerOption{option: option, kind: kind})
+	}
+	s.Value.AddOptions(options...)
+}
+
+// ofKind marks the options added by the function as options of the kind
+func (s *NmapScanner) ofKind(kind optionKind, fn tengo.CallableFunc) tengo.CallableFunc {
+	return func(args ...tengo.Object) (tengo.Object, error) {
+		n := len(s.options)
+
+		ret, err := fn(args...)
+		for i := n; i < len(s.options); i++ {
+			s.options[i].kind = kind
+		}
+
+		return ret, err
+	}
+}
+
+func (s *NmapScanner) setToFile(path string) {
+	s.toFile = path
+	s.Value.ToFile(path)
+}
+
+// clone creates a new scanner with the same options that runs with the context
+func (s *NmapScanner) clone(ctx context.Context) (*nmap.Scanner, error) {
+	var options []nmap.Option
+	for _, o := range s.options {
+		options = append(options, o.option)
+	}
+
+	scanner, err := nmap.NewScanner(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.toFile != "" {
+		scanner.ToFile(s.toFile)
+	}
+
+	return scanner, nil
+}
+
+// cloneScanOptions creates a new scanner that runs with the context, with the same options except for
+// the targets and output files
+func (s *NmapScanner) cloneScanOptions(ctx context.Context) (*nmap.Scanner, error) {
+	var options []nmap.Option
+	for _, o := range s.options {
+		if o.kind == scanOption {
+			options = append(options, o.option)
+		}
+	}
+
+	return nmap.NewScanner(ctx, options...)
 }
 
 // addOptionA transform a function of 'func() nmap.Option' signature
@@ -27,7 +109,7 @@ func (s *NmapScanner) addOptionA(fn func() nmap.Option) tengo.CallableFunc {
 	return func(args ...tengo.Object) (tengo.Object, error) {
 		option := fn()
 
-		s.Value.AddOptions(option)
+		s.addOptions(option)
 		return s, nil
 	}
 }
@@ -42,7 +124,7 @@ func (s *NmapScanner) addOptionAS(fn func(string) nmap.Option) tengo.CallableFun
 			first, _ := args.GetString("first")
 			option := fn(first)
 
-			s.Value.AddOptions(option)
+			s.addOptions(option)
 			return s, nil
 		},
 	}
@@ -60,7 +142,7 @@ func (s *NmapScanner) addOptionAI(fn func(int) nmap.Option) tengo.CallableFunc {
 			first, _ := args.GetInt("first")
 			option := fn(first)
 
-			s.Value.AddOptions(option)
+			s.addOptions(option)
 			return s, nil
 		},
 	}
@@ -77,7 +159,7 @@ func (s *NmapScanner) addOptionAI16(fn func(int16) nmap.Option) tengo.CallableFu
 			first, _ := args.GetInt("first")
 			option := fn(int16(first))
 
-			s.Value.AddOptions(option)
+			s.addOptions(option)
 			return s, nil
 		},
 	}
@@ -100,7 +182,7 @@ func (s *NmapScanner) addOptionAD(fn func(time.Duration) nmap.Option) tengo.Call
 
 			option := fn(dur)
 
-			s.Value.AddOptions(option)
+			s.addOptions(option)
 			return s, nil
 		},
 	}
@@ -116,13 +198,82 @@ func (s *NmapScanner) addOptionASv(fn func(...string) nmap.Option) tengo.Callabl
 			strings, _ := args.GetStringSlice("first")
 			option := fn(strings...)
 
-			s.Value.AddOptions(option)
+			s.addOptions(option)
 			return s, nil
 		},
 	}
 	return advFunc.Call
 }
 
+// valueFlags are the nmap flags taking their value from the next argument
+var valueFlags = map[string]bool{
+	"-p": true, "-e": true, "-S": true, "-D": true, "-g": true, "-b": true, "-sI": true,
+	"-iL": true, "-iR": true, "-oN": true, "-oX": true, "-oS": true, "-oG": true, "-oA": true, "-oM": true,
+	"--exclude": true, "--excludefile": true, "--exclude-ports": true, "--source-port": true,
+	"--top-ports": true, "--port-ratio": true, "--scanflags": true, "--script": true,
+	"--script-args": true, "--script-args-file": true, "--script-timeout": true,
+	"--version-intensity": true, "--max-os-tries": true, "--min-hostgroup": true, "--max-hostgroup": true,
+	"--min-parallelism": true, "--max-parallelism": true, "--min-rtt-timeout": true,
+	"--max-rtt-timeout": true, "--initial-rtt-timeout": true, "--max-retries": true,
+	"--host-timeout": true, "--scan-delay": true, "--max-scan-delay": true, "--min-rate": true,
+	"--max-rate": true, "--mtu": true, "--data": true, "--data-string": true, "--data-length": true,
+	"--ip-options": true, "--ttl": true, "--spoof-mac": true, "--proxies": true, "--dns-servers": true,
+	"--stats-every": true, "--datadir": true, "--servicedb": true, "--versiondb": true,
+	"--stylesheet": true, "--resume": true,
+}
+
+// splitCustomArgs splits the custom arguments into the scan options, the targets and the outputs.
+// Targets are the bare hosts and the -iL and -iR flags, and outputs are the -o flags and --resume.
+func splitCustomArgs(args []string) ([]string, []string, []string) {
+	var scan, targets, outputs []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		flag := arg
+		if strings.HasPrefix(arg, "--") {
+			flag, _, _ = strings.Cut(arg, "=")
+		}
+
+		values := args[i : i+1]
+		if valueFlags[arg] && i+1 < len(args) {
+			values = args[i : i+2]
+			i++
+		}
+
+		switch {
+		case !strings.HasPrefix(arg, "-"):
+			targets = append(targets, values...)
+		case strings.HasPrefix(flag, "-i"):
+			targets = append(targets, values...)
+		case strings.HasPrefix(flag, "-o") || flag == "--resume":
+			outputs = append(outputs, values...)
+		default:
+			scan = append(scan, values...)
+		}
+	}
+
+	return scan, targets, outputs
+}
+
+// customArgs adds the custom arguments. The targets and outputs they contain are kept apart, so they
+// are left out of the chunks of batched scans like the other targets and outputs.
+// Represents 'scanner.custom_args(args ...string) NmapScanner'
+func (s *NmapScanner) customArgs(args interop.ArgMap) (tengo.Object, error) {
+	customArgs, _ := args.GetStringSlice("args")
+
+	scan, targets, outputs := splitCustomArgs(customArgs)
+	if len(scan) > 0 {
+		s.addOptionsOfKind(scanOption, nmap.WithCustomArguments(scan...))
+	}
+	if len(targets) > 0 {
+		s.addOptionsOfKind(targetOption, nmap.WithCustomArguments(targets...))
+	}
+	if len(outputs) > 0 {
+		s.addOptionsOfKind(outputOption, nmap.WithCustomArguments(outputs...))
+	}
+
+	return s, nil
+}
+
 // aliasFunc is used to call the same tengo function using a different name
 func (s *NmapScanner) aliasFunc(name string, src string) *tengo.UserFunction {
 	return interop.AliasFunc(s, name, src)
@@ -130,7 +281,7 @@ func (s *NmapScanner) aliasFunc(name string, src string) *tengo.UserFunction {
 
 func (s *NmapScanner) xmlOutput(args interop.ArgMap) (tengo.Object, error) {
 	s1, _ := args.GetString("path")
-	s.Value.ToFile(s1)
+	s.setToFile(s1)
 
 	return s, nil
 }
@@ -138,23 +289,139 @@ func (s *NmapScanner) xmlOutput(args interop.ArgMap) (tengo.Object, error) {
 func (s *NmapScanner) allOutput(args interop.ArgMap) (tengo.Object, error) {
 	s1, _ := args.GetString("path")
 
-	s.Value.AddOptions(
+	s.addOptionsOfKind(outputOption,
 		nmap.WithGrepOutput(fmt.Sprintf("%s.gnmap", s1)),
 		nmap.WithNmapOutput(fmt.Sprintf("%s.nmap", s1)),
 	)
-	s.Value.ToFile(fmt.Sprintf("%s.xml", s1))
+	s.setToFile(fmt.Sprintf("%s.xml", s1))
 
 	return s, nil
 }
 
+// nseQuoteChars are the characters that must be quoted in the value of an NSE script argument
+const nseQuoteChars string = ",={}'\" \t\n\\"
+
+var nseQuoteEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// quoteScriptArg quotes the value of an NSE script argument if it contains characters that NSE would
+// otherwise parse as part of the argument list
+func quoteScriptArg(value string) string {
+	if !strings.ContainsAny(value, nseQuoteChars) {
+		return value
+	}
+
+	return `"` + nseQuoteEscaper.Replace(value) + `"`
+}
+
+// scriptArgs adds the NSE script arguments. The arguments are sorted by key, unlike nmap.WithScriptArguments,
+// so the same map always produces the same command line. Nothing is added for an empty map.
+func (s *NmapScanner) scriptArgs(args interop.ArgMap) (tengo.Object, error) {
+	scriptArgs, _ := args.GetStrMapStr("args")
+	if len(scriptArgs) == 0 {
+		return s, nil
+	}
+
+	var keys []string
+	for key := range scriptArgs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var argList []string
+	for _, key := range keys {
+		if scriptArgs[key] == "" {
+			argList = append(argList, key)
+		} else {
+			argList = append(argList, fmt.Sprintf("%s=%s", key, quoteScriptArg(scriptArgs[key])))
+		}
+	}
+
+	s.addOptions(nmap.WithCustomArguments(fmt.Sprintf("--script-args=%s", strings.Join(argList, ","))))
+	return s, nil
+}
+
 func (s *NmapScanner) timingTemplate(args interop.ArgMap) (tengo.Object, error) {
 	timing, _ := args.GetInt("timing")
 
 	option := nmap.WithTimingTemplate(nmap.Timing(timing))
-	s.Value.AddOptions(option)
+	s.addOptions(option)
 	return s, nil
 }
 
+// tailInterval is how often the XML output is checked for new content while nmap runs
+const tailInterval time.Duration = 100 * time.Millisecond
+
+// tailFile copies the content written to the file to w until the returned function is called, which
+// copies the rest of the file before returning
+func tailFile(path string, w io.Writer) func() {
+	done := make(chan struct{})
+	finished := make(chan struct{})
+
+	go func() {
+		defer close(finished)
+
+		file, err := os.Open(path)
+		if err != nil {
+			return
+		}
+		defer file.Close()
+
+		for {
+			_, err = io.Copy(w, file)
+			if err != nil {
+				return
+			}
+
+			select {
+			case <-done:
+				io.Copy(w, file)
+				return
+			case <-time.After(tailInterval):
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
+// runScanner runs the scanner, adding any warnings to the error. The XML output is written to xmlPath,
+// or a temporary file if it is empty, and copied to w while nmap runs if w isn't nil. The output isn't
+// streamed by nmap.Scanner, as its streamer races with Run.
+func runScanner(scanner *nmap.Scanner, xmlPath string, w io.Writer) (*nmap.Run, error) {
+	if xmlPath == "" {
+		file, err := os.CreateTemp("", "nmap-*.xml")
+		if err != nil {
+			return nil, err
+		}
+		file.Close()
+		defer os.Remove(file.Name())
+
+		xmlPath = file.Name()
+	} else {
+		// Make sure the output of a previous scan isn't copied to w
+		err := os.WriteFile(xmlPath, nil, 0644)
+		if err != nil {
+			return nil, err
+		}
+	}
+	scanner.ToFile(xmlPath)
+
+	if w != nil {
+		stop := tailFile(xmlPath, w)
+		defer stop()
+	}
+
+	run, warnings, err := scanner.Run()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %s", err, strings.Join(*warnings, "\n"))
+	}
+
+	return run, nil
+}
+
 // TypeName should return the name of the type.
 func (s *NmapScanner) TypeName() string {
 	return "nmap-scanner"
@@ -176,16 +443,15 @@ func (s *NmapScanner) CanIterate() bool {
 	return false
 }
 
-func makeNmapScanner() (*NmapScanner, error) {
-	scanner, err := nmap.NewScanner(context.Background())
+func makeNmapScanner(m *module) (*NmapScanner, error) {
+	scanner, err := nmap.NewScanner(m.ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	scanner.Streamer(os.Stdout)
-
 	nmapScanner := &NmapScanner{
-		Value: scanner,
+		Value:  scanner,
+		module: m,
 	}
 
 	objectMap := map[string]tengo.Object{
@@ -234,12 +500,12 @@ func makeNmapScanner() (*NmapScanner, error) {
 		},
 		"grep_output": &tengo.UserFunction{
 			Name:  "grep_output",
-			Value: nmapScanner.addOptionAS(nmap.WithGrepOutput),
+			Value: nmapScanner.ofKind(outputOption, nmapScanner.addOptionAS(nmap.WithGrepOutput)),
 		},
 		"oG": nmapScanner.aliasFunc("oG", "grep_output"),
 		"nmap_output": &tengo.UserFunction{
 			Name:  "nmap_output",
-			Value: nmapScanner.addOptionAS(nmap.WithNmapOutput),
+			Value: nmapScanner.ofKind(outputOption, nmapScanner.addOptionAS(nmap.WithNmapOutput)),
 		},
 		"oN": nmapScanner.aliasFunc("oN", "nmap_output"),
 		"xml_output": &interop.AdvFunction{
@@ -262,7 +528,7 @@ func makeNmapScanner() (*NmapScanner, error) {
 		},
 		"target_input": &tengo.UserFunction{
 			Name:  "target_input",
-			Value: nmapScanner.addOptionAS(nmap.WithTargetInput),
+			Value: nmapScanner.ofKind(targetOption, nmapScanner.addOptionAS(nmap.WithTargetInput)),
 		},
 		"iL": nmapScanner.aliasFunc("iL", "target_input"),
 		"host_timeout": &tengo.UserFunction{
@@ -291,7 +557,7 @@ func makeNmapScanner() (*NmapScanner, error) {
 		},
 		"targets": &tengo.UserFunction{
 			Name:  "targets",
-			Value: nmapScanner.addOptionASv(nmap.WithTargets),
+			Value: nmapScanner.ofKind(targetOption, nmapScanner.addOptionASv(nmap.WithTargets)),
 		},
 		"timing_template": &interop.AdvFunction{
 			Name:    "timing_template",
@@ -303,7 +569,7 @@ func makeNmapScanner() (*NmapScanner, error) {
 			Name: "T0",
 			Value: func(args ...tengo.Object) (tengo.Object, error) {
 				option := nmap.WithTimingTemplate(nmap.TimingSlowest)
-				nmapScanner.Value.AddOptions(option)
+				nmapScanner.addOptions(option)
 				return nmapScanner, nil
 			},
 		},
@@ -311,7 +577,7 @@ func makeNmapScanner() (*NmapScanner, error) {
 			Name: "T1",
 			Value: func(args ...tengo.Object) (tengo.Object, error) {
 				option := nmap.WithTimingTemplate(nmap.TimingSneaky)
-				nmapScanner.Value.AddOptions(option)
+				nmapScanner.addOptions(option)
 				return nmapScanner, nil
 			},
 		},
@@ -319,7 +585,7 @@ func makeNmapScanner() (*NmapScanner, error) {
 			Name: "T2",
 			Value: func(args ...tengo.Object) (tengo.Object, error) {
 				option := nmap.WithTimingTemplate(nmap.TimingPolite)
-				nmapScanner.Value.AddOptions(option)
+				nmapScanner.addOptions(option)
 				return nmapScanner, nil
 			},
 		},
@@ -327,7 +593,7 @@ func makeNmapScanner() (*NmapScanner, error) {
 			Name: "T3",
 			Value: func(args ...tengo.Object) (tengo.Object, error) {
 				option := nmap.WithTimingTemplate(nmap.TimingNormal)
-				nmapScanner.Value.AddOptions(option)
+				nmapScanner.addOptions(option)
 				return nmapScanner, nil
 			},
 		},
@@ -335,7 +601,7 @@ func makeNmapScanner() (*NmapScanner, error) {
 			Name: "T4",
 			Value: func(args ...tengo.Object) (tengo.Object, error) {
 				option := nmap.WithTimingTemplate(nmap.TimingAggressive)
-				nmapScanner.Value.AddOptions(option)
+				nmapScanner.addOptions(option)
 				return nmapScanner, nil
 			},
 		},
@@ -343,7 +609,7 @@ func makeNmapScanner() (*NmapScanner, error) {
 			Name: "T5",
 			Value: func(args ...tengo.Object) (tengo.Object, error) {
 				option := nmap.WithTimingTemplate(nmap.TimingFastest)
-				nmapScanner.Value.AddOptions(option)
+				nmapScanner.addOptions(option)
 				return nmapScanner, nil
 			},
 		},
@@ -352,13 +618,42 @@ func makeNmapScanner() (*NmapScanner, error) {
 			Value: nmapScanner.addOptionA(nmap.WithAggressiveScan),
 		},
 		"A": nmapScanner.aliasFunc("A", "aggressive_scan"),
+		"scripts": &tengo.UserFunction{
+			Name:  "scripts",
+			Value: nmapScanner.addOptionASv(nmap.WithScripts),
+		},
+		"script": nmapScanner.aliasFunc("script", "scripts"),
+		"default_scripts": &tengo.UserFunction{
+			Name:  "default_scripts",
+			Value: nmapScanner.addOptionA(nmap.WithDefaultScript),
+		},
+		"sC": nmapScanner.aliasFunc("sC", "default_scripts"),
+		"script_args": &interop.AdvFunction{
+			Name:    "script_args",
+			NumArgs: interop.ExactArgs(1),
+			Args:    []interop.AdvArg{interop.StrMapStrArg("args")},
+			Value:   nmapScanner.scriptArgs,
+		},
+		"script_args_file": &tengo.UserFunction{
+			Name:  "script_args_file",
+			Value: nmapScanner.addOptionAS(nmap.WithScriptArgumentsFile),
+		},
+		"script_timeout": &tengo.UserFunction{
+			Name:  "script_timeout",
+			Value: nmapScanner.addOptionAD(nmap.WithScriptTimeout),
+		},
+		"script_trace": &tengo.UserFunction{
+			Name:  "script_trace",
+			Value: nmapScanner.addOptionA(nmap.WithScriptTrace),
+		},
 		"args": &tengo.UserFunction{
 			Name:  "args",
 			Value: stdlib.FuncARSs(nmapScanner.Value.Args),
 		},
-		"custom_args": &tengo.UserFunction{
+		"custom_args": &interop.AdvFunction{
 			Name:  "custom_args",
-			Value: nmapScanner.addOptionASv(nmap.WithCustomArguments),
+			Args:  []interop.AdvArg{interop.StrSliceArg("args", true)},
+			Value: nmapScanner.customArgs,
 		},
 		"privileged": &tengo.UserFunction{
 			Name:  "privileged",
@@ -371,14 +666,30 @@ func makeNmapScanner() (*NmapScanner, error) {
 		"run": &tengo.UserFunction{
 			Name: "run",
 			Value: func(args ...tengo.Object) (tengo.Object, error) {
-				run, warnings, err := nmapScanner.Value.Run()
+				scanner, err := nmapScanner.clone(m.ctx)
 				if err != nil {
-					return interop.GoErrToTErr(fmt.Errorf("%v: %s", err, strings.Join(*warnings, "\n"))), nil
+					return interop.GoErrToTErr(err), nil
+				}
+
+				run, err := runScanner(scanner, nmapScanner.toFile, os.Stdout)
+				if err != nil {
+					return interop.GoErrToTErr(err), nil
 				}
 
 				return makeNmapRun(run), nil
 			},
 		},
+		"run_async": &interop.AdvFunction{
+			Name:    "run_async",
+			NumArgs: interop.MaxArgs(1),
+			Args: []interop.AdvArg{
+				interop.MapArg("options",
+					interop.CompileFuncArg("on_progress"),
+					interop.StrArg("stats_every"),
+				),
+			},
+			Value: nmapScanner.runAsync,
+		},
 	}
 
 	nmapScanner.PropObject = types.PropObject{
@@ -388,54 +699,3 @@ func makeNmapScanner() (*NmapScanner, error) {
 
 	return nmapScanner, nil
 }
-
-// NmapRun represents a simple tengo object wrapper for *nmap.Run
-type NmapRun struct {
-	types.PropObject
-	Value *nmap.Run
-}
-
-// TypeName should return the name of the type.
-func (s *NmapRun) TypeName() string {
-	return "nmap-run"
-}
-
-// String should return a string representation of the type's value.
-func (r *NmapRun) String() string {
-	bytes, _ := io.ReadAll(r.Value.ToReader())
-	return string(bytes)
-}
-
-// IsFalsy should return true if the value of the type should be considered
-// as falsy.
-func (r *NmapRun) IsFalsy() bool {
-	return r.Value == nil
-}
-
-// CanIterate should return whether the Object can be Iterated.
-func (r *NmapRun) CanIterate() bool {
-	return false
-}
-
-func makeNmapRun(run *nmap.Run) *NmapRun {
-	nmapRun := &NmapRun{
-		Value: run,
-	}
-
-	var ports []int
-	for _, h := range nmapRun.Value.Hosts {
-		for _, p := range h.Ports {
-			ports = append(ports, int(p.ID))
-		}
-	}
-
-	// Currently only need ports, probably will want to implement more
-	nmapRun.PropObject = types.PropObject{
-		ObjectMap: make(map[string]tengo.Object),
-		Properties: map[string]types.Property{
-			"ports": types.StaticProperty(interop.GoIntSliceToTArray(ports)),
-		},
-	}
-
-	return nmapRun
-}
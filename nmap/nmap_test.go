@@ -0,0 +1,444 @@
+package nmap_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/analog-substance/tengo/v2/require"
+	"github.com/analog-substance/tengomod/internal/test"
+)
+
+const scanA = `<?xml version="1.0" encoding="UTF-8"?>
+<nmaprun scanner="nmap" args="nmap -sV 10.0.0.1 10.0.0.2" start="1700000000" version="7.94" xmloutputversion="1.05">
+<host starttime="1700000001" endtime="1700000010">
+<status state="up" reason="syn-ack"/>
+<address addr="10.0.0.1" addrtype="ipv4"/>
+<hostnames><hostname name="a.example.com" type="PTR"/></hostnames>
+<ports>
+<port protocol="tcp" portid="22"><state state="open" reason="syn-ack"/><service name="ssh" product="OpenSSH" version="8.9" method="probed" conf="10"><cpe>cpe:/a:openbsd:openssh:8.9</cpe></service></port>
+<port protocol="tcp" portid="80"><state state="open" reason="syn-ack"/><service name="http" product="nginx" version="1.18.0" method="probed" conf="10"/><script id="http-title" output="Welcome"><elem key="title">Welcome</elem></script></port>
+</ports>
+</host>
+<host>
+<status state="up" reason="syn-ack"/>
+<address addr="10.0.0.2" addrtype="ipv4"/>
+<ports>
+<port protocol="tcp" portid="443"><state state="open" reason="syn-ack"/><service name="https" method="table" conf="3"/></port>
+</ports>
+</host>
+<runstats><finished time="1700000020" elapsed="20.5" summary="done" exit="success"/><hosts up="2" down="0" total="2"/></runstats>
+</nmaprun>
+`
+
+const scanB = `<?xml version="1.0" encoding="UTF-8"?>
+<nmaprun scanner="nmap" args="nmap -sV 10.0.0.1 10.0.0.3" start="1700001000" version="7.94" xmloutputversion="1.05">
+<host>
+<status state="up" reason="syn-ack"/>
+<address addr="10.0.0.1" addrtype="ipv4"/>
+<ports>
+<port protocol="tcp" portid="80"><state state="open" reason="syn-ack"/><service name="http" product="nginx" version="1.25.0" method="probed" conf="10"/></port>
+<port protocol="tcp" portid="8080"><state state="open" reason="syn-ack"/><service name="http-proxy" method="table" conf="3"/></port>
+</ports>
+</host>
+<host>
+<status state="up" reason="syn-ack"/>
+<address addr="10.0.0.3" addrtype="ipv4"/>
+<ports>
+<port protocol="udp" portid="53"><state state="open" reason="udp-response"/><service name="domain" method="table" conf="3"/></port>
+</ports>
+</host>
+<runstats><finished time="1700001010" elapsed="10" summary="done" exit="success"/><hosts up="2" down="0" total="2"/></runstats>
+</nmaprun>
+`
+
+const scanOS = `<?xml version="1.0" encoding="UTF-8"?>
+<nmaprun scanner="nmap" args="nmap -O -sC 10.0.0.5" start="1700002000" version="7.94" xmloutputversion="1.05">
+<prescript><script id="broadcast-ping" output="no hosts"/></prescript>
+<host>
+<status state="up" reason="echo-reply"/>
+<address addr="10.0.0.5" addrtype="ipv4"/>
+<address addr="00:11:22:33:44:55" addrtype="mac" vendor="Acme"/>
+<hostnames><hostname name="db.example.com" type="user"/></hostnames>
+<ports>
+<port protocol="tcp" portid="3306"><state state="filtered" reason="no-response"/><service name="mysql" extrainfo="protocol 10" tunnel="ssl" method="table" conf="3"/><script id="ssl-cert" output="Subject: db"><table key="subject"><elem key="commonName">db</elem></table></script></port>
+</ports>
+<os><osmatch name="Linux 5.X" accuracy="96"><osclass type="general purpose" vendor="Linux" osfamily="Linux" osgen="5.X" accuracy="96"><cpe>cpe:/o:linux:linux_kernel:5</cpe></osclass></osmatch></os>
+<hostscript><script id="smb-os-discovery" output="Samba"><elem key="os">Unix</elem></script></hostscript>
+</host>
+<postscript><script id="reverse-index" output="3306/tcp: 10.0.0.5"/></postscript>
+<runstats><finished time="1700002030" elapsed="30" summary="1 IP address (1 host up) scanned" exit="success"/><hosts up="1" down="2" total="3"/></runstats>
+</nmaprun>
+`
+
+func writeScan(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+// fakeNmap puts an nmap script in the PATH that outputs the XML
+func fakeNmap(t *testing.T, xml string) {
+	fakeNmapScript(t, fmt.Sprintf("cat %q > \"$out\"", writeScan(t, "scan.xml", xml)))
+}
+
+// fakeNmapScript puts an nmap shell script with the body in the PATH. The body writes the XML to $out,
+// the path given to -oX.
+func fakeNmapScript(t *testing.T, body string) {
+	dir := t.TempDir()
+
+	script := fmt.Sprintf(`#!/bin/sh
+out=""
+prev=""
+for arg in "$@"; do
+	[ "$prev" = "-oX" ] && out="$arg"
+	prev="$arg"
+done
+%s
+`, body)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "nmap"), []byte(script), 0755))
+
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestNmapParse(t *testing.T) {
+	compiled := test.RunScript(t, fmt.Sprintf(`
+nmap := import("nmap")
+run := nmap.parse(%q)
+host := run.hosts[0]
+port := host.ports[1]
+summary := [
+	len(run.hosts), run.ports, run.stats.up, run.stats.elapsed, run.truncated,
+	host.address, host.hostnames[0].name, host.status.state,
+	port.id, port.protocol, port.state, port.service.product, port.service.version,
+	port.scripts[0].id, port.scripts[0].elements[0].value,
+	host.ports[0].service.cpes[0]
+]
+`, scanA))
+	require.Equal(t, test.Object(test.ARR{
+		2, test.ARR{22, 80, 443}, 2, 20.5, false,
+		"10.0.0.1", "a.example.com", "up",
+		80, "tcp", "open", "nginx", "1.18.0",
+		"http-title", "Welcome",
+		"cpe:/a:openbsd:openssh:8.9",
+	}), compiled.Get("summary").Object())
+
+	test.Module(t, "nmap").Call("parse", "not xml").ExpectTengoError()
+}
+
+func TestNmapRun(t *testing.T) {
+	compiled := test.RunScript(t, fmt.Sprintf(`
+nmap := import("nmap")
+run := nmap.parse(%q)
+host := run.hosts[0]
+port := host.ports[0]
+os := host.os_matches[0]
+table := port.script("ssl-cert").tables[0]
+summary := [
+	run.args, run.version, run.pre_scripts[0].id, run.post_scripts[0].output,
+	run.stats.summary, run.stats.exit, run.stats.down, run.stats.total,
+	host.address, host.addresses[1].addr, host.addresses[1].type, host.addresses[1].vendor,
+	host.hostnames[0].type, host.status.reason,
+	os.name, os.accuracy, os.classes[0].family, os.classes[0].generation, os.classes[0].cpes[0],
+	host.scripts[0].id, host.script("smb-os-discovery").elements[0].value, is_undefined(host.script("bogus")),
+	port.state, port.reason, port.service.extra_info, port.service.tunnel, port.service.method, port.service.confidence,
+	table.key, table.elements[0].key, table.elements[0].value
+]
+start := run.start
+end := run.stats.end
+`, scanOS))
+	require.Equal(t, test.Object(test.ARR{
+		"nmap -O -sC 10.0.0.5", "7.94", "broadcast-ping", "3306/tcp: 10.0.0.5",
+		"1 IP address (1 host up) scanned", "success", 2, 3,
+		"10.0.0.5", "00:11:22:33:44:55", "mac", "Acme",
+		"user", "echo-reply",
+		"Linux 5.X", 96, "Linux", "5.X", "cpe:/o:linux:linux_kernel:5",
+		"smb-os-discovery", "Unix", true,
+		"filtered", "no-response", "protocol 10", "ssl", "table", 3,
+		"subject", "commonName", "db",
+	}), compiled.Get("summary").Object())
+	require.Equal(t, int64(1700002000), compiled.Get("start").Value().(time.Time).Unix())
+	require.Equal(t, int64(1700002030), compiled.Get("end").Value().(time.Time).Unix())
+}
+
+func TestNmapParseTruncated(t *testing.T) {
+	// Cut the XML in the middle of the second host
+	truncated := scanA[:strings.Index(scanA, `<address addr="10.0.0.2"`)]
+
+	compiled := test.RunScript(t, fmt.Sprintf(`
+nmap := import("nmap")
+run := nmap.parse(%q)
+summary := [run.truncated, len(run.hosts), run.ports]
+`, truncated))
+	require.Equal(t, test.Object(test.ARR{true, 1, test.ARR{22, 80}}), compiled.Get("summary").Object())
+}
+
+func TestNmapParseFileMerge(t *testing.T) {
+	pathA := writeScan(t, "a.xml", scanA)
+	pathB := writeScan(t, "b.xml", scanB)
+
+	compiled := test.RunScript(t, fmt.Sprintf(`
+nmap := import("nmap")
+run := nmap.parse_file(%q, %q)
+merged := nmap.merge(nmap.parse_file(%q), nmap.parse_file(%q))
+summary := [len(run.hosts), run.ports, run.stats.total, run.stats.up, run.stats.down, run.stats.elapsed, run.hosts[0].ports[1].service.version, merged.ports]
+missing := is_error(nmap.parse_file(%q))
+`, pathA, pathB, pathA, pathB, filepath.Join(t.TempDir(), "missing.xml")))
+	require.Equal(t, test.Object(test.ARR{
+		3, test.ARR{22, 80, 8080, 443, 53}, 3, 3, 0, 1010.0, "1.25.0", test.ARR{22, 80, 8080, 443, 53},
+	}), compiled.Get("summary").Object())
+	require.True(t, compiled.Get("missing").Bool())
+}
+
+func TestNmapDiff(t *testing.T) {
+	compiled := test.RunScript(t, fmt.Sprintf(`
+nmap := import("nmap")
+diff := nmap.diff(nmap.parse(%q), nmap.parse(%q))
+opened := []
+for p in diff.opened_ports {
+	opened = append(opened, p.host + ":" + p.port)
+}
+closed := []
+for p in diff.closed_ports {
+	closed = append(closed, p.host + ":" + p.port)
+}
+summary := [diff.has_changes, diff.new_hosts, diff.removed_hosts, opened, closed, diff.service_changes[0].after]
+text := diff.to_text()
+markdown := diff.to_markdown()
+unchanged := nmap.diff(nmap.parse(%q), nmap.parse(%q)).has_changes
+`, scanA, scanB, scanA, scanA))
+	require.Equal(t, test.Object(test.ARR{
+		true,
+		test.ARR{"10.0.0.3"},
+		test.ARR{"10.0.0.2"},
+		test.ARR{"10.0.0.1:8080", "10.0.0.3:53"},
+		test.ARR{"10.0.0.1:22", "10.0.0.2:443"},
+		"http nginx 1.25.0",
+	}), compiled.Get("summary").Object())
+	require.False(t, compiled.Get("unchanged").Bool())
+
+	require.Equal(t, `New hosts:
+  10.0.0.3
+Removed hosts:
+  10.0.0.2
+Opened ports:
+  10.0.0.1 8080/tcp http-proxy
+  10.0.0.3 53/udp domain
+Closed ports:
+  10.0.0.1 22/tcp ssh OpenSSH 8.9
+  10.0.0.2 443/tcp https
+Service changes:
+  10.0.0.1 80/tcp: http nginx 1.18.0 -> http nginx 1.25.0
+`, compiled.Get("text").String())
+	require.True(t, strings.Contains(compiled.Get("markdown").String(), "| 10.0.0.1 | 80/tcp | http nginx 1.18.0 | http nginx 1.25.0 |"))
+
+	// Pipes in cells are escaped so they don't break the table
+	piped := strings.Replace(scanB, `version="1.25.0"`, `version="1.25.0|beta"`, 1)
+	compiled = test.RunScript(t, fmt.Sprintf(`
+nmap := import("nmap")
+markdown := nmap.diff(nmap.parse(%q), nmap.parse(%q)).to_markdown()
+`, scanA, piped))
+	require.True(t, strings.Contains(compiled.Get("markdown").String(), "| 10.0.0.1 | 80/tcp | http nginx 1.18.0 | http nginx 1.25.0\\|beta |"))
+
+	test.Module(t, "nmap").Call("diff", "a", "b").ExpectError()
+}
+
+func TestNmapScripts(t *testing.T) {
+	fakeNmap(t, scanA)
+
+	compiled := test.RunScript(t, `
+nmap := import("nmap")
+scanner := nmap.scanner().scripts("http-title", "banner").script_args({b: "2", a: ""}).script_timeout("30s").default_scripts()
+args := scanner.args()
+quoted := nmap.scanner().script_args({"http.useragent": "Mozilla/5.0 (X11)", q: "say \"hi\""}).script_args({}).args()
+run := scanner.run()
+port := run.hosts[0].ports[1]
+outputs := [port.script("http-title").output, is_undefined(port.script("banner")), is_undefined(run.hosts[0].script("smb-os-discovery"))]
+`)
+	require.Equal(t, test.Object(test.ARR{
+		"--script=http-title,banner", "--script-args=a,b=2", "--script-timeout", "30000ms", "-sC",
+	}), compiled.Get("args").Object())
+	require.Equal(t, test.Object(test.ARR{
+		`--script-args=http.useragent="Mozilla/5.0 (X11)",q="say \"hi\""`,
+	}), compiled.Get("quoted").Object())
+	require.Equal(t, test.Object(test.ARR{"Welcome", true, true}), compiled.Get("outputs").Object())
+}
+
+func TestNmapRunAsync(t *testing.T) {
+	header := scanA[:strings.Index(scanA, "<host ")]
+	rest := scanA[len(header):]
+
+	fakeNmapScript(t, fmt.Sprintf(`printf '%%s' %q > "$out"
+echo '<taskprogress task="SYN Stealth Scan" time="1700000005" percent="25.00" remaining="30" etc="1700000035"/>' >> "$out"
+sleep 0.2
+echo '<taskprogress task="SYN Stealth Scan" time="1700000010" percent="50.50" remaining="10" etc="1700000020"/>' >> "$out"
+sleep 0.2
+printf '%%s' %q >> "$out"`, header, rest))
+
+	// The callback updates the globals while the script keeps running
+	compiled := test.RunScript(t, `
+nmap := import("nmap")
+percents := []
+scan := nmap.scanner().targets("10.0.0.1").run_async({on_progress: func(p) {
+	percents = append(percents, p.percent)
+}, stats_every: "1s"})
+busy := 0
+for i := 0; i < 100000; i++ {
+	busy += len(percents)
+}
+run := scan.wait()
+ports := run.ports
+last := scan.progress()
+summary := [last.task, last.remaining, scan.is_running()]
+etc := last.etc
+`)
+	require.Equal(t, test.Object(test.ARR{25.0, 50.5}), compiled.Get("percents").Object())
+	require.Equal(t, test.Object(test.ARR{22, 80, 443}), compiled.Get("ports").Object())
+	require.Equal(t, test.Object(test.ARR{"SYN Stealth Scan", "10s", false}), compiled.Get("summary").Object())
+	require.Equal(t, int64(1700000020), compiled.Get("etc").Value().(time.Time).Unix())
+
+	fakeNmapScript(t, "exec sleep 5")
+
+	compiled = test.RunScript(t, `
+nmap := import("nmap")
+scan := nmap.scanner().run_async()
+scan.cancel()
+canceled := string(scan.wait()) == string(nmap.err_canceled)
+`)
+	require.True(t, compiled.Get("canceled").Bool())
+}
+
+func TestNmapScanBatched(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "invocations.log")
+
+	// Writes a host with port 80 open for each target to the -oX file
+	fakeNmapScript(t, fmt.Sprintf(`out=""
+targets=""
+while [ $# -gt 0 ]; do
+	case "$1" in
+		-oX) out="$2"; shift ;;
+		-p|-iL) shift ;;
+		-*) ;;
+		*) targets="$targets $1" ;;
+	esac
+	shift
+done
+echo "$targets" >> %q
+{
+	echo '<?xml version="1.0"?><nmaprun scanner="nmap" args="nmap" start="1700000000" version="7.94">'
+	for target in $targets; do
+		echo "<host><status state=\"up\"/><address addr=\"$target\" addrtype=\"ipv4\"/><ports><port protocol=\"tcp\" portid=\"80\"><state state=\"open\"/></port></ports></host>"
+	done
+	echo '<runstats><finished time="1700000010" elapsed="1"/><hosts up="1" down="0" total="1"/></runstats></nmaprun>'
+} > "$out"`, logPath))
+
+	outputDir := filepath.Join(t.TempDir(), "batches")
+	script := fmt.Sprintf(`
+nmap := import("nmap")
+run := nmap.scan_batched(nmap.scanner(), ["10.0.0.0/30", "10.0.1.5"], {chunk_size: 2, concurrency: 2, output_dir: %q})
+hosts := []
+for host in run.hosts {
+	hosts = append(hosts, host.address)
+}
+`, outputDir)
+
+	invocations := func() int {
+		content, err := os.ReadFile(logPath)
+		if os.IsNotExist(err) {
+			return 0
+		}
+		require.NoError(t, err)
+		return strings.Count(string(content), "\n")
+	}
+
+	compiled := test.RunScript(t, script)
+	require.Equal(t, test.Object(test.ARR{"10.0.0.0", "10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.1.5"}), compiled.Get("hosts").Object())
+	require.Equal(t, 3, invocations())
+
+	// Completed chunks are skipped when rerun with the same output directory
+	require.NoError(t, os.Remove(filepath.Join(outputDir, "chunk-00001.xml")))
+	compiled = test.RunScript(t, script)
+	require.Equal(t, 5, len(compiled.Get("hosts").Array()))
+	require.Equal(t, 4, invocations())
+
+	// The targets and outputs of the scanner aren't used by the chunks
+	compiled = test.RunScript(t, fmt.Sprintf(`
+nmap := import("nmap")
+scanner := nmap.scanner().targets("10.9.9.9").oN(%q).all_output(%q)
+scanner.custom_args("-p", "80", "10.9.9.8", "-oX", %q, "-iL", %q)
+run := nmap.scan_batched(scanner, ["10.0.2.1", "10.0.2.2"], {chunk_size: 1})
+hosts := []
+for host in run.hosts {
+	hosts = append(hosts, host.address)
+}
+args := scanner.args()
+`, filepath.Join(t.TempDir(), "scan.nmap"), filepath.Join(t.TempDir(), "all"), filepath.Join(t.TempDir(), "custom.xml"), filepath.Join(t.TempDir(), "targets.txt")))
+	require.Equal(t, test.Object(test.ARR{"10.0.2.1", "10.0.2.2"}), compiled.Get("hosts").Object())
+	require.Equal(t, 6, invocations())
+	require.True(t, strings.Contains(compiled.Get("args").String(), `"-p", "80", "10.9.9.8", "-iL"`), compiled.Get("args").String())
+
+	test.Module(t, "nmap").Call("scan_batched", "not a scanner", test.ARR{"10.0.0.1"}).ExpectError()
+}
+
+func TestNmapExport(t *testing.T) {
+	csvPath := filepath.Join(t.TempDir(), "services.csv")
+
+	compiled := test.RunScript(t, fmt.Sprintf(`
+nmap := import("nmap")
+run := nmap.parse(%q)
+csv_err := run.to_csv(%q, ["host", "port", "proto", "service"])
+json := run.to_json(["host", "port"])
+markdown := run.to_markdown()
+bad_column := is_error(run.to_markdown(["host", "bogus"]))
+`, scanA, csvPath))
+	require.Nil(t, compiled.Get("csv_err").Value())
+	require.True(t, compiled.Get("bad_column").Bool())
+
+	bytes, err := os.ReadFile(csvPath)
+	require.NoError(t, err)
+	require.Equal(t, "host,port,proto,service\n10.0.0.1,22,tcp,ssh\n10.0.0.1,80,tcp,http\n10.0.0.2,443,tcp,https\n", string(bytes))
+
+	require.Equal(t, `[{"host":"10.0.0.1","port":"22"},{"host":"10.0.0.1","port":"80"},{"host":"10.0.0.2","port":"443"}]`, compiled.Get("json").String())
+	require.Equal(t, `| host | hostname | port | proto | service | product | version |
+| --- | --- | --- | --- | --- | --- | --- |
+| 10.0.0.1 | a.example.com | 22 | tcp | ssh | OpenSSH | 8.9 |
+| 10.0.0.1 | a.example.com | 80 | tcp | http | nginx | 1.18.0 |
+| 10.0.0.2 |  | 443 | tcp | https |  |  |
+`, compiled.Get("markdown").String())
+}
+
+func TestNmapQuery(t *testing.T) {
+	compiled := test.RunScript(t, fmt.Sprintf(`
+nmap := import("nmap")
+run := nmap.parse(%q)
+with_80 := []
+for host in run.hosts_with_port(80) {
+	with_80 = append(with_80, host.address)
+}
+udp_80 := len(run.hosts_with_port(80, "udp"))
+http := []
+for s in run.services("^http") {
+	http = append(http, s.host + ":" + s.port + " " + s.product)
+}
+by_host := run.open_ports_by_host()
+targets := run.web_targets()
+`, scanA))
+	require.Equal(t, test.Object(test.ARR{"10.0.0.1"}), compiled.Get("with_80").Object())
+	require.Equal(t, 0, compiled.Get("udp_80").Int())
+	require.Equal(t, test.Object(test.ARR{"10.0.0.1:80 nginx", "10.0.0.2:443 "}), compiled.Get("http").Object())
+	require.Equal(t, test.Object(test.IMAP{"10.0.0.1": test.ARR{22, 80}, "10.0.0.2": test.ARR{443}}), compiled.Get("by_host").Object())
+	require.Equal(t, test.Object(test.ARR{"http://10.0.0.1:80", "https://10.0.0.2:443"}), compiled.Get("targets").Object())
+
+	// Only web services are targets, not services sharing their prefix
+	scan := strings.Replace(scanB, `<port protocol="udp"`, `<port protocol="tcp" portid="593"><state state="open"/><service name="http-rpc-epmap" method="table" conf="3"/></port>
+<port protocol="tcp" portid="8443"><state state="open"/><service name="http" tunnel="ssl" method="probed" conf="10"/></port>
+<port protocol="udp"`, 1)
+	compiled = test.RunScript(t, fmt.Sprintf(`
+nmap := import("nmap")
+targets := nmap.parse(%q).web_targets()
+`, scan))
+	require.Equal(t, test.Object(test.ARR{"http://10.0.0.1:80", "http://10.0.0.1:8080", "https://10.0.0.3:8443"}), compiled.Get("targets").Object())
+}
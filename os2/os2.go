@@ -3,7 +3,6 @@ package os2
 import (
 	"bufio"
 	"context"
-	"errors"
 	"fmt"
 	"os"
 
@@ -202,7 +201,7 @@ func (m *module) readStdin(args interop.ArgMap) (tengo.Object, error) {
 // Represents 'os2.temp_chdir(dir string, fn func())'
 func (m *module) tempChdir(args interop.ArgMap) (tengo.Object, error) {
 	if m.getCompiled == nil {
-		return nil, errors.New("module not setup to run compiled functions from Go code")
+		return nil, interop.ErrNoCompiled
 	}
 
 	compiled := m.getCompiled()
@@ -41,17 +41,17 @@ var (
 		"set": func(_ *ModuleOptions) map[string]tengo.Object {
 			return set.Module()
 		},
-		"nmap": func(_ *ModuleOptions) map[string]tengo.Object {
-			return nmap.Module()
+		"nmap": func(o *ModuleOptions) map[string]tengo.Object {
+			return nmap.Module(o.getCompiled, o.ctx)
 		},
-		"exec": func(_ *ModuleOptions) map[string]tengo.Object {
-			return exec.Module()
+		"exec": func(o *ModuleOptions) map[string]tengo.Object {
+			return exec.Module(o.getCompiled, o.ctx)
 		},
 		"log": func(_ *ModuleOptions) map[string]tengo.Object {
 			return log.Module()
 		},
-		"ffuf": func(opt *ModuleOptions) map[string]tengo.Object {
-			return ffuf.Module(opt.ctx)
+		"ffuf": func(o *ModuleOptions) map[string]tengo.Object {
+			return ffuf.Module(o.getCompiled, o.ctx)
 		},
 		"net": func(_ *ModuleOptions) map[string]tengo.Object {
 			return net.Module()